@@ -3,16 +3,22 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"github.com/pkg/errors"
 	"github.com/tetratom/cloudsurvey/pkg/config"
 	"github.com/tetratom/cloudsurvey/pkg/core"
 	"github.com/tetratom/cloudsurvey/pkg/metric"
 	_ "github.com/tetratom/cloudsurvey/plugins"
+	"github.com/tetratom/cloudsurvey/plugins/output/stdout"
 	"golang.org/x/sync/errgroup"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/debug"
+	"syscall"
 	"time"
 )
 
@@ -20,20 +26,36 @@ const (
 	defaultConfigPath = "/etc/cloudsurvey/cloudsurvey.conf"
 )
 
-var (
-	newline = []byte{'\n'}
-)
+type options struct {
+	config           string
+	configDirectory  string
+	verbose          bool
+	daemon           bool
+	sourceFilter     string
+	credentialFilter string
+	format           string
+}
 
 func main() {
-	var opts struct {
-		config  string
-		verbose bool
-	}
+	var opts options
 
 	flag.StringVar(&opts.config, "config", defaultConfigPath, "path to configuration file")
+	flag.StringVar(&opts.configDirectory, "config-directory", "", "directory of additional configuration files")
 	flag.BoolVar(&opts.verbose, "verbose", false, "enable verbose output to stderr")
+	flag.BoolVar(&opts.daemon, "daemon", false, "keep running, collecting each source on its interval")
+	flag.StringVar(&opts.sourceFilter, "source-filter", "", "comma-separated list of source plugins")
+	flag.StringVar(&opts.credentialFilter, "credential-filter", "", "comma-separated list of credential plugins")
+	flag.StringVar(&opts.format, "format", "", "format of the stdout output: influx or json")
+	flag.Usage = usage
 	flag.Parse()
 
+	command := "run"
+	if flag.NArg() > 0 {
+		// flags may also follow the command
+		command = flag.Arg(0)
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+	}
+
 	if opts.verbose {
 		// it's default but let's be certain
 		log.SetOutput(os.Stderr)
@@ -42,9 +64,91 @@ func main() {
 	}
 
 	log.Printf("cloudsurvey: %s %s", version(), runtime.Version())
+
+	switch command {
+	case "run":
+		run(opts)
+	case "validate":
+		validate(opts)
+	case "config":
+		sampleConfig(opts)
+	case "test":
+		testSources(opts)
+	case "serve":
+		serve(opts)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", command)
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `usage: cloudsurvey [flags] [command]
+
+commands:
+  run       collect metrics from all sources (default)
+  validate  check the configuration, including plugin options
+  config    print a sample configuration of all plugins, limited by the
+            credential and source filters
+  test      run the sources once, limited by the source filter, and print
+            their data and errors in a readable form
+  serve     collect the sources on their intervals, and serve their data
+            to prometheus
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+func loadConfig(opts options) (*config.Config, error) {
 	log.Printf("config: %s", opts.config)
 
-	conf, err := config.FromFile(opts.config)
+	paths := []string{opts.config}
+	if opts.configDirectory != "" {
+		log.Printf("config directory: %s", opts.configDirectory)
+		paths = append(paths, opts.configDirectory)
+	}
+
+	conf, err := config.FromPaths(paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.format != "" {
+		if err := setStdoutFormat(conf, opts.format); err != nil {
+			return nil, err
+		}
+	}
+
+	return conf, nil
+}
+
+// setStdoutFormat sets the format of every stdout output, including the
+// default output if no outputs are configured. It fails if none of the
+// outputs is an enabled stdout output, as the format would have no effect.
+func setStdoutFormat(conf *config.Config, format string) error {
+	if len(conf.Outputs) == 0 {
+		conf.Outputs = map[string][]*config.Output{
+			config.DefaultOutput: {&config.Output{}},
+		}
+	}
+
+	var enabled bool
+	for _, output := range conf.Outputs[stdout.PluginName] {
+		output.Set("format", format)
+		enabled = enabled || !output.Disabled
+	}
+
+	if !enabled {
+		return errors.New("--format: no stdout output configured")
+	}
+
+	return nil
+}
+
+func run(opts options) {
+	conf, err := loadConfig(opts)
 	if err != nil {
 		log.Fatal("error: load config:", err)
 	}
@@ -56,38 +160,34 @@ func main() {
 
 	ch := make(chan metric.Datum, 100)
 	eg, c := errgroup.WithContext(context.Background())
-	w := os.Stdout
+
+	// the sources are cancelled on interrupt, but the outputs keep draining
+	// the channel until they have all returned
+	runCtx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("received %s, stopping", sig)
+		cancel()
+	}()
 
 	start := time.Now()
 
 	eg.Go(func() error {
 		defer close(ch)
-		return runner.Run(c, ch)
-	})
 
-	eg.Go(func() error {
-		for datum := range ch {
-			select {
-			case <-c.Done():
-				return c.Err()
-			default:
-			}
-
-			wire, err := datum.ToInfluxDBWireProtocol()
-			if err != nil {
-				return err
-			}
-
-			if _, err := w.Write([]byte(wire)); err != nil {
-				return err
-			}
-
-			if _, err := w.Write(newline); err != nil {
-				return err
-			}
+		if opts.daemon {
+			return runner.Daemon(runCtx, ch)
 		}
 
-		return nil
+		return runner.Run(runCtx, ch)
+	})
+
+	eg.Go(func() error {
+		return runner.Output(c, ch)
 	})
 
 	if err := eg.Wait(); err != nil {
@@ -98,6 +198,117 @@ func main() {
 	log.Printf("elapsed %d ms", end.Sub(start).Nanoseconds()/1000000)
 }
 
+// serve collects the sources in the background, and serves their data in the
+// Prometheus text format until interrupted.
+func serve(opts options) {
+	conf, err := loadConfig(opts)
+	if err != nil {
+		fatal(errors.Wrap(err, "load config"))
+	}
+
+	runner, err := core.NewRunner(context.Background(), conf)
+	if err != nil {
+		fatal(err)
+	}
+
+	listen := conf.Exporter.Listen
+	if listen == "" {
+		listen = config.DefaultExporterListen
+	}
+
+	path := conf.Exporter.Path
+	if path == "" {
+		path = config.DefaultExporterPath
+	}
+
+	staleGrace := conf.Exporter.StaleGrace
+	if staleGrace == 0 {
+		staleGrace = config.DefaultStaleGrace
+	}
+
+	exporter := core.NewExporter(runner, staleGrace)
+
+	mux := http.NewServeMux()
+	mux.Handle(path, exporter)
+	server := &http.Server{Addr: listen, Handler: mux}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("received %s, stopping", sig)
+		cancel()
+	}()
+
+	eg, c := errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		return exporter.Run(c)
+	})
+
+	eg.Go(func() error {
+		log.Printf("serving %s on %s", path, listen)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			return err
+		}
+
+		return nil
+	})
+
+	eg.Go(func() error {
+		<-c.Done()
+		return server.Shutdown(context.Background())
+	})
+
+	if err := eg.Wait(); err != nil {
+		fatal(err)
+	}
+}
+
+// validate reports every unknown option in the configuration, and then any
+// error in setting up the plugins, to stderr.
+func validate(opts options) {
+	conf, err := loadConfig(opts)
+	if err == nil {
+		err = core.Validate(conf)
+	}
+
+	if err == nil {
+		_, err = core.NewRunner(context.Background(), conf)
+	}
+
+	if verr, ok := err.(*core.ValidationError); ok {
+		for _, problem := range verr.Problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println("configuration is valid")
+}
+
+func sampleConfig(opts options) {
+	err := writeSampleConfig(
+		os.Stdout,
+		parseList(opts.credentialFilter),
+		parseList(opts.sourceFilter))
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// fatal reports err to stderr regardless of --verbose, and exits.
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
 func version() string {
 	if info, ok := debug.ReadBuildInfo(); ok {
 		if version := info.Main.Version; version != "" {
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/core"
+	"github.com/tetratom/cloudsurvey/plugins/output/stdout"
+	"testing"
+)
+
+func TestSetStdoutFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		outputs int
+	}{
+		{"default output", ``, 1},
+		{"configured outputs", "[[outputs.stdout]]\n[[outputs.stdout]]\nformat = \"influx\"", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf, err := config.FromString(test.config)
+			require.NoError(t, err)
+			require.NoError(t, setStdoutFormat(conf, "json"))
+
+			runner, err := core.NewRunner(context.Background(), conf)
+			require.NoError(t, err)
+			require.Equal(t, test.outputs, len(runner.Outputs))
+
+			for _, output := range runner.Outputs {
+				require.Equal(t, "json", output.Plugin.(*stdout.Stdout).Format)
+			}
+		})
+	}
+
+	t.Run("no stdout output", func(t *testing.T) {
+		for _, configString := range []string{
+			"[[outputs.influxdb]]",
+			"[[outputs.influxdb]]\n[[outputs.stdout]]\ndisabled = true",
+		} {
+			conf, err := config.FromString(configString)
+			require.NoError(t, err)
+			require.EqualError(t, setStdoutFormat(conf, "json"), "--format: no stdout output configured")
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"io"
+	"strings"
+)
+
+const sampleMainConfig = `[main]
+## log to stderr
+# verbose = false
+
+## default collection interval of sources in daemon mode
+# interval = "1m"
+
+## deadline for all sources to complete in a single run
+# run_timeout = "0s"
+
+## reject options not understood by cloudsurvey or its plugins
+# strict = false
+
+[exporter]
+## address and path on which cloudsurvey serve exposes metrics
+# listen = ":9542"
+# path = "/metrics"
+
+## how long to keep serving the data of a source that has started to fail
+# stale_grace = "5m"`
+
+// writeSampleConfig writes a sample configuration with the default
+// configuration of every credential, source, processor and output plugin.
+// Only the DefaultOutput is enabled, while the processors and the other
+// outputs are commented out, as they act on data without being asked to. A
+// non-empty filter limits the credential or source plugins to those named.
+func writeSampleConfig(w io.Writer, credentialFilter, sourceFilter []string) error {
+	credentials, err := filterNames(registry.ListCredentials(), credentialFilter)
+	if err != nil {
+		return errors.Wrap(err, "credential filter")
+	}
+
+	sources, err := filterNames(registry.ListSources(), sourceFilter)
+	if err != nil {
+		return errors.Wrap(err, "source filter")
+	}
+
+	fmt.Fprintf(w, "# cloudsurvey configuration\n\n%s\n", sampleMainConfig)
+
+	writeSampleHeader(w, "credentials")
+	for _, name := range credentials {
+		init, err := registry.GetCredentials(name)
+		if err != nil {
+			return err
+		}
+
+		writeSamplePlugin(w, init(nil))
+	}
+
+	writeSampleHeader(w, "sources")
+	for _, name := range sources {
+		init, err := registry.GetSource(name)
+		if err != nil {
+			return err
+		}
+
+		writeSamplePlugin(w, init(nil))
+	}
+
+	writeSampleHeader(w, "processors")
+	for _, name := range registry.ListProcessors() {
+		init, err := registry.GetProcessor(name)
+		if err != nil {
+			return err
+		}
+
+		writeSampleCommented(w, init())
+	}
+
+	writeSampleHeader(w, "outputs")
+	for _, name := range registry.ListOutputs() {
+		init, err := registry.GetOutput(name)
+		if err != nil {
+			return err
+		}
+
+		if name == config.DefaultOutput {
+			writeSamplePlugin(w, init())
+		} else {
+			writeSampleCommented(w, init())
+		}
+	}
+
+	return nil
+}
+
+func writeSampleHeader(w io.Writer, title string) {
+	line := strings.Repeat("#", 79)
+	fmt.Fprintf(w, "\n%s\n# %s\n%s\n", line, title, line)
+}
+
+func writeSamplePlugin(w io.Writer, plugin registry.Plugin) {
+	fmt.Fprintf(w, "\n# %s\n%s\n", plugin.Description(), strings.TrimSpace(plugin.DefaultConfig()))
+}
+
+// writeSampleCommented writes the default configuration of a plugin commented
+// out, such that it is only enabled by removing the leading "# ".
+func writeSampleCommented(w io.Writer, plugin registry.Plugin) {
+	lines := strings.Split(strings.TrimSpace(plugin.DefaultConfig()), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "# " + line
+		}
+	}
+
+	fmt.Fprintf(w, "\n# %s\n%s\n", plugin.Description(), strings.Join(lines, "\n"))
+}
+
+// filterNames returns the names included by the filter, or all names if the
+// filter is empty. Every name in the filter must exist.
+func filterNames(names []string, filter []string) ([]string, error) {
+	if len(filter) == 0 {
+		return names, nil
+	}
+
+	exists := make(map[string]bool)
+	for _, name := range names {
+		exists[name] = true
+	}
+
+	var result []string
+	for _, name := range filter {
+		if !exists[name] {
+			return nil, errors.Errorf("plugin not found: %s", name)
+		}
+
+		result = append(result, name)
+	}
+
+	return result, nil
+}
+
+// parseList splits a comma-separated list, as given to the filter flags.
+func parseList(s string) []string {
+	var result []string
+
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/core"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"testing"
+)
+
+func TestWriteSampleConfig(t *testing.T) {
+	t.Run("all plugins", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeSampleConfig(&buf, nil, nil))
+
+		conf, err := config.FromString(buf.String())
+		require.NoError(t, err)
+		require.NoError(t, core.Validate(conf))
+		require.Equal(t, len(registry.ListCredentials()), len(conf.Credentials))
+		require.Equal(t, len(registry.ListSources()), len(conf.Sources))
+		require.Equal(t, 0, len(conf.Processors))
+		require.Equal(t, 1, len(conf.Outputs))
+		require.Contains(t, conf.Outputs, config.DefaultOutput)
+
+		for _, name := range registry.ListProcessors() {
+			require.Contains(t, buf.String(), "\n# [[processors."+name+"]]\n")
+		}
+
+		for _, name := range registry.ListOutputs() {
+			if name != config.DefaultOutput {
+				require.Contains(t, buf.String(), "\n# [[outputs."+name+"]]\n")
+			}
+		}
+	})
+
+	t.Run("commented plugins", func(t *testing.T) {
+		var snippets []string
+
+		for _, name := range registry.ListProcessors() {
+			init, err := registry.GetProcessor(name)
+			require.NoError(t, err)
+			snippets = append(snippets, init().DefaultConfig())
+		}
+
+		for _, name := range registry.ListOutputs() {
+			init, err := registry.GetOutput(name)
+			require.NoError(t, err)
+			snippets = append(snippets, init().DefaultConfig())
+		}
+
+		for _, snippet := range snippets {
+			conf, err := config.FromString(snippet)
+			require.NoError(t, err, snippet)
+			require.NoError(t, core.Validate(conf), snippet)
+		}
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeSampleConfig(&buf, nil, []string{"aws_iam_users"}))
+
+		conf, err := config.FromString(buf.String())
+		require.NoError(t, err)
+		require.Equal(t, 1, len(conf.Sources))
+		require.Contains(t, conf.Sources, "aws_iam_users")
+	})
+
+	t.Run("unknown plugin", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := writeSampleConfig(&buf, []string{"gcp"}, nil)
+		require.EqualError(t, err, "credential filter: plugin not found: gcp")
+	})
+}
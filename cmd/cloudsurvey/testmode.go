@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/core"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// testSources runs the sources once, limited by the source filter, and
+// prints their data and errors in a human-readable form.
+func testSources(opts options) {
+	conf, err := loadConfig(opts)
+	if err != nil {
+		fatal(errors.Wrap(err, "load config"))
+	}
+
+	if err := filterSources(conf, parseList(opts.sourceFilter)); err != nil {
+		fatal(err)
+	}
+
+	runner, err := core.NewRunner(context.Background(), conf)
+	if err != nil {
+		fatal(err)
+	}
+
+	printer := prettyPrinter{w: os.Stdout}
+	runner.Report = printer.Result
+
+	ch := make(chan metric.Datum, 100)
+	go func() {
+		defer close(ch)
+		_ = runner.Run(context.Background(), ch)
+	}()
+
+	for datum := range ch {
+		printer.Datum(datum)
+	}
+}
+
+// filterSources removes all sources from the configuration, except for those
+// named. Every name must have been configured.
+func filterSources(conf *config.Config, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	sources := make(map[string][]*config.Source)
+	for _, name := range names {
+		confs, ok := conf.Sources[name]
+		if !ok {
+			return errors.Errorf("source not configured: %s", name)
+		}
+
+		sources[name] = confs
+	}
+
+	conf.Sources = sources
+	return nil
+}
+
+// prettyPrinter writes data and the errors of sources in a human-readable
+// form. It is safe for concurrent use.
+type prettyPrinter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (p *prettyPrinter) Datum(datum metric.Datum) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.w, "%s %s\n", datum.Name, datum.Time.Format(time.RFC3339))
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "  \tname\ttype\tvalue\n")
+
+	for _, k := range sortedStringKeys(datum.Tags) {
+		fmt.Fprintf(tw, "  tag\t%s\tstring\t%s\n", k, datum.Tags[k])
+	}
+
+	keys := make([]string, 0, len(datum.Fields))
+	for k := range datum.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value, typ := formatField(datum.Fields[k])
+		fmt.Fprintf(tw, "  field\t%s\t%s\t%s\n", k, typ, value)
+	}
+
+	_ = tw.Flush()
+	fmt.Fprintln(p.w)
+}
+
+func (p *prettyPrinter) Result(result core.Result) {
+	if result.Err == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	name := result.Source.Name
+	if result.Source.Session != "" {
+		name += " (" + result.Source.Session + ")"
+	}
+
+	if result.Err == core.ErrTimeout {
+		fmt.Fprintf(p.w, "error: source %s: timed out after %s\n\n", name, result.Duration)
+	} else {
+		fmt.Fprintf(p.w, "error: source %s: %s\n\n", name, result.Err)
+	}
+}
+
+// formatField returns a readable representation of a field value, along with
+// its type.
+func formatField(value interface{}) (string, string) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String(), "duration"
+	case time.Time:
+		return v.Format(time.RFC3339Nano), "time"
+	case string:
+		return strconv.Quote(v), "string"
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), "float"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), "float"
+	case fmt.Stringer:
+		return v.String(), reflect.TypeOf(value).String()
+	case nil:
+		return "(nil)", ""
+	default:
+		return fmt.Sprint(v), reflect.TypeOf(value).String()
+	}
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/core"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"testing"
+	"time"
+)
+
+func TestPrettyPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	printer := prettyPrinter{w: &buf}
+
+	printer.Datum(metric.Datum{
+		Name: "aws_iam_user",
+		Time: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags: map[string]string{"user_name": "bob", "user_path": "/friends/"},
+		Fields: map[string]interface{}{
+			"age":              90 * time.Minute,
+			"active_key_count": 1,
+		},
+	})
+
+	printer.Result(core.Result{
+		Source: &core.SourceInstance{Name: "aws_iam_users", Session: "root"},
+		Err:    errors.New("AccessDenied"),
+	})
+
+	require.Equal(t, `aws_iam_user 2019-01-02T03:04:05Z
+         name              type      value
+  tag    user_name         string    bob
+  tag    user_path         string    /friends/
+  field  active_key_count  int       1
+  field  age               duration  1h30m0s
+
+error: source aws_iam_users (root): AccessDenied
+
+`, buf.String())
+}
+
+func TestFilterSources(t *testing.T) {
+	conf, err := config.FromString(`
+[[sources.aws_iam_users]]
+[[sources.aws_ec2_instances]]
+[[sources.aws_ec2_instances]]
+`)
+	require.NoError(t, err)
+
+	require.EqualError(t, filterSources(conf, []string{"aws_ce_daily"}), "source not configured: aws_ce_daily")
+	require.NoError(t, filterSources(conf, []string{"aws_ec2_instances"}))
+	require.Equal(t, 1, len(conf.Sources))
+	require.Equal(t, 2, len(conf.Sources["aws_ec2_instances"]))
+}
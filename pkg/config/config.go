@@ -3,21 +3,56 @@ package config
 import (
 	"github.com/pelletier/go-toml"
 	"io"
-	"log"
+	"time"
 )
 
 const (
 	EnvVarPrefix = "CLOUDSURVEY_"
+
+	// DefaultInterval is the collection interval of a source in daemon mode,
+	// if neither the source nor [main] specify one.
+	DefaultInterval = time.Minute
+
+	// DefaultOutput is the output plugin used if no outputs are configured.
+	DefaultOutput = "stdout"
+
+	// DefaultExporterListen and DefaultExporterPath are where the exporter
+	// serves metrics, unless [exporter] specifies otherwise.
+	DefaultExporterListen = ":9542"
+	DefaultExporterPath   = "/metrics"
+
+	// DefaultStaleGrace is how long the exporter keeps serving the data of a
+	// source whose executions have failed.
+	DefaultStaleGrace = 5 * time.Minute
 )
 
 type Config struct {
 	Main        Main                     `toml:"main"`
+	Exporter    Exporter                 `toml:"exporter"`
 	Credentials map[string][]*Credential `toml:"credentials"`
 	Sources     map[string][]*Source     `toml:"sources"`
+	Processors  map[string][]*Processor  `toml:"processors"`
+	Outputs     map[string][]*Output     `toml:"outputs"`
+
+	// full representation of the underlying toml structure
+	tree *toml.Tree
 }
 
 type Main struct {
-	Verbose bool `toml:"verbose"`
+	Verbose    bool          `toml:"verbose"`
+	Interval   time.Duration `toml:"interval"`
+	RunTimeout time.Duration `toml:"run_timeout"`
+
+	// Strict rejects any option that is not understood by cloudsurvey or
+	// the plugin that it is given to.
+	Strict bool `toml:"strict"`
+}
+
+// Exporter configures the Prometheus exporter, started by cloudsurvey serve.
+type Exporter struct {
+	Listen     string        `toml:"listen"`
+	Path       string        `toml:"path"`
+	StaleGrace time.Duration `toml:"stale_grace"`
 }
 
 type Credential struct {
@@ -41,6 +76,18 @@ type Source struct {
 	Scopes     []string          `toml:"scopes"`
 	MetricTags map[string]string `toml:"metric_tags"`
 	Disabled   bool              `toml:"disabled"`
+	Interval   time.Duration     `toml:"interval"`
+	Timeout    time.Duration     `toml:"timeout"`
+
+	// filtering of the data of the source, as with metric.Filter
+	NamePass   []string            `toml:"namepass"`
+	NameDrop   []string            `toml:"namedrop"`
+	TagPass    map[string][]string `toml:"tagpass"`
+	TagDrop    map[string][]string `toml:"tagdrop"`
+	FieldPass  []string            `toml:"fieldpass"`
+	FieldDrop  []string            `toml:"fielddrop"`
+	TagInclude []string            `toml:"taginclude"`
+	TagExclude []string            `toml:"tagexclude"`
 
 	// full representation of the underlying toml structure for
 	// configuring source plugins
@@ -51,16 +98,78 @@ func (s *Source) Configure(x interface{}) error {
 	return s.tree.Unmarshal(x)
 }
 
+type Processor struct {
+	Disabled bool `toml:"disabled"`
+
+	// Order is the position of the processor in the chain, in ascending
+	// order. Processors of the same order are chained by plugin name, and
+	// then in the order they are configured.
+	Order int `toml:"order"`
+
+	// selection of the data processed, as with metric.Filter; other data
+	// pass by unchanged
+	NamePass []string            `toml:"namepass"`
+	NameDrop []string            `toml:"namedrop"`
+	TagPass  map[string][]string `toml:"tagpass"`
+	TagDrop  map[string][]string `toml:"tagdrop"`
+
+	// full representation of the underlying toml structure for
+	// configuring processor plugins
+	tree *toml.Tree
+}
+
+func (p *Processor) Configure(x interface{}) error {
+	return p.tree.Unmarshal(x)
+}
+
+type Output struct {
+	Disabled bool `toml:"disabled"`
+
+	// routing of data to the output, as with metric.Filter
+	NamePass []string            `toml:"namepass"`
+	NameDrop []string            `toml:"namedrop"`
+	TagPass  map[string][]string `toml:"tagpass"`
+	TagDrop  map[string][]string `toml:"tagdrop"`
+
+	// full representation of the underlying toml structure for
+	// configuring output plugins
+	tree *toml.Tree
+}
+
+func (o *Output) Configure(x interface{}) error {
+	// the default output is not backed by any configuration
+	if o.tree == nil {
+		return nil
+	}
+
+	return o.tree.Unmarshal(x)
+}
+
+// Set sets an option of the output, as if it had been configured.
+func (o *Output) Set(key string, value interface{}) {
+	if o.tree == nil {
+		o.tree, _ = toml.TreeFromMap(map[string]interface{}{})
+	}
+
+	o.tree.Set(key, value)
+}
+
 func FromTree(tree *toml.Tree) (*Config, error) {
 	if err := ApplyEnvironmentVariables(tree); err != nil {
 		return nil, err
 	}
 
+	if err := Interpolate(tree); err != nil {
+		return nil, err
+	}
+
 	var config Config
 	if err := tree.Unmarshal(&config); err != nil {
 		return nil, err
 	}
 
+	config.tree = tree
+
 	for k, vs := range config.Credentials {
 		for i := range vs {
 			// bit of a workaround, as tree.Get() doesn't appear to
@@ -87,6 +196,20 @@ func FromTree(tree *toml.Tree) (*Config, error) {
 		}
 	}
 
+	for k, vs := range config.Processors {
+		for i := range vs {
+			slice := tree.Get("processors." + k).([]*toml.Tree)
+			vs[i].tree = slice[i]
+		}
+	}
+
+	for k, vs := range config.Outputs {
+		for i := range vs {
+			slice := tree.Get("outputs." + k).([]*toml.Tree)
+			vs[i].tree = slice[i]
+		}
+	}
+
 	return &config, nil
 }
 
@@ -125,11 +248,3 @@ func FromBytes(bytes []byte) (*Config, error) {
 
 	return FromTree(tree)
 }
-
-// ApplyEnvironmentVariables will overwrite any values in the tree for which
-// an environmental override of the form CLOUDSURVEY_... is found. Overrides
-// follow the same conventions as InfluxDB.
-func ApplyEnvironmentVariables(tree *toml.Tree) error {
-	log.Print("warning: ApplyEnvironmentVariables is not implemented")
-	return nil
-}
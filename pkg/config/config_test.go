@@ -43,6 +43,8 @@ func TestFromString(t *testing.T) {
 			conf, err := FromString(test.input)
 			require.NoError(t, err)
 
+			conf.tree = nil
+
 			for _, vs := range conf.Credentials {
 				for i := range vs {
 					vs[i].tree = nil
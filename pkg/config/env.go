@@ -0,0 +1,360 @@
+package config
+
+import (
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// ApplyEnvironmentVariables will overwrite any values in the tree for which
+// an environmental override of the form CLOUDSURVEY_... is found. Overrides
+// follow the same conventions as InfluxDB.
+//
+// The name of an override is the upper-cased path of the key, joined by
+// underscores, e.g. CLOUDSURVEY_MAIN_VERBOSE for main.verbose. Entries of
+// credential and source plugins are addressed by their index, such as
+// CLOUDSURVEY_CREDENTIALS_AWS_0_REGION, or all at once by omitting the index.
+// Values are converted to the type of the key they replace, or else to that
+// of the common configuration fields. Plugin options that do not appear in the
+// file are set as strings, unless they read as a bool or contain a comma, in
+// which case they are set as a bool or a list of strings respectively.
+func ApplyEnvironmentVariables(tree *toml.Tree) error {
+	env := make(map[string]string)
+
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, EnvVarPrefix) {
+			continue
+		}
+
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	return applyEnvironment(tree, env)
+}
+
+func applyEnvironment(tree *toml.Tree, env map[string]string) error {
+	if len(env) == 0 {
+		return nil
+	}
+
+	prefix := strings.TrimSuffix(EnvVarPrefix, "_")
+	return applyEnvironmentToTable(tree, prefix, reflect.TypeOf(Config{}), env, false, nil)
+}
+
+// applyEnvironmentToTable applies the overrides to the keys of a table, whose
+// known keys are described by typ. If discover is true, overrides for keys
+// not otherwise known are added to the table, unless they fall under one of
+// the excluded prefixes.
+func applyEnvironmentToTable(
+	tree *toml.Tree,
+	prefix string,
+	typ reflect.Type,
+	env map[string]string,
+	discover bool,
+	exclude []string,
+) error {
+	fields := tomlFields(typ)
+	keys := tree.Keys()
+	for key := range fields {
+		if !tree.HasPath([]string{key}) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// names of the overrides, and of the tables of overrides, that have been
+	// claimed by known keys
+	claimed := make(map[string]bool)
+	claimedTables := make(map[string]bool)
+
+	for _, key := range keys {
+		name := prefix + "_" + envName(key)
+		fieldType := fields[key]
+		value := tree.GetPath([]string{key})
+
+		switch {
+		case isPluginMap(fieldType):
+			sub, ok := value.(*toml.Tree)
+			if !ok {
+				continue
+			}
+
+			if err := applyEnvironmentToPlugins(sub, name, fieldType.Elem().Elem().Elem(), env); err != nil {
+				return err
+			}
+
+			claimedTables[name] = true
+
+		case fieldType != nil && fieldType.Kind() == reflect.Map:
+			for _, k := range envNamesWithPrefix(env, name+"_") {
+				tree.SetPath([]string{key, strings.ToLower(k[len(name)+1:])}, env[k])
+			}
+
+			claimedTables[name] = true
+
+		case fieldType != nil && fieldType.Kind() == reflect.Struct && fieldType != timeType:
+			sub, ok := value.(*toml.Tree)
+			if !ok {
+				if len(envNamesWithPrefix(env, name+"_")) == 0 {
+					continue
+				}
+
+				sub, _ = toml.TreeFromMap(map[string]interface{}{})
+				tree.SetPath([]string{key}, sub)
+			}
+
+			if err := applyEnvironmentToTable(sub, name, fieldType, env, false, nil); err != nil {
+				return err
+			}
+
+			claimedTables[name] = true
+
+		case fieldType == nil && reflect.TypeOf(value) == reflect.TypeOf(tree):
+			if err := applyEnvironmentToTable(value.(*toml.Tree), name, nil, env, false, nil); err != nil {
+				return err
+			}
+
+			claimedTables[name] = true
+
+		case fieldType == nil && value != nil && reflect.TypeOf(value).Kind() == reflect.Slice:
+			if _, ok := value.([]interface{}); !ok {
+				// arrays of tables cannot be overridden
+				continue
+			}
+
+			fallthrough
+
+		default:
+			claimed[name] = true
+
+			s, ok := env[name]
+			if !ok {
+				continue
+			}
+
+			v, err := coerceEnvValue(s, value, fieldType)
+			if err != nil {
+				return errors.Wrap(err, name)
+			}
+
+			tree.SetPath([]string{key}, v)
+		}
+	}
+
+	if !discover {
+		return nil
+	}
+
+	for _, name := range envNamesWithPrefix(env, prefix+"_") {
+		rest := name[len(prefix)+1:]
+		if rest == "" || !unicode.IsLetter(rune(rest[0])) {
+			// indexed overrides are applied separately
+			continue
+		}
+
+		if claimed[name] || isClaimed(claimedTables, name) || hasAnyPrefix(name, exclude) {
+			continue
+		}
+
+		v, err := coerceEnvValue(env[name], nil, nil)
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+
+		tree.SetPath([]string{strings.ToLower(rest)}, v)
+	}
+
+	return nil
+}
+
+// applyEnvironmentToPlugins applies the overrides to a table of plugin
+// configurations, such as [credentials] or [sources].
+func applyEnvironmentToPlugins(tree *toml.Tree, prefix string, typ reflect.Type, env map[string]string) error {
+	plugins := tree.Keys()
+	sort.Strings(plugins)
+
+	for _, plugin := range plugins {
+		entries, ok := tree.GetPath([]string{plugin}).([]*toml.Tree)
+		if !ok {
+			continue
+		}
+
+		name := prefix + "_" + envName(plugin)
+
+		// plugins with longer names may share the prefix of this one
+		var exclude []string
+		for _, other := range plugins {
+			if other != plugin && strings.HasPrefix(other, plugin+"_") {
+				exclude = append(exclude, prefix+"_"+envName(other)+"_")
+			}
+		}
+
+		for i, entry := range entries {
+			if err := applyEnvironmentToTable(entry, name, typ, env, true, exclude); err != nil {
+				return err
+			}
+
+			indexed := name + "_" + strconv.Itoa(i)
+			if err := applyEnvironmentToTable(entry, indexed, typ, env, true, exclude); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// coerceEnvValue converts s to the type of the existing value, or else to the
+// type of the known field. If neither is given, the type is inferred.
+func coerceEnvValue(s string, existing interface{}, fieldType reflect.Type) (interface{}, error) {
+	switch existing.(type) {
+	case bool:
+		return strconv.ParseBool(s)
+	case int64:
+		return strconv.ParseInt(s, 10, 64)
+	case uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case float64:
+		return strconv.ParseFloat(s, 64)
+	case time.Time:
+		return time.Parse(time.RFC3339Nano, s)
+	case []interface{}:
+		return splitEnvList(s), nil
+	case string:
+		if fieldType != durationType {
+			return s, nil
+		}
+	}
+
+	if fieldType != nil && fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	if fieldType == nil {
+		if b, err := strconv.ParseBool(s); err == nil && strings.ToLower(s) == strconv.FormatBool(b) {
+			return b, nil
+		}
+
+		if strings.Contains(s, ",") {
+			return splitEnvList(s), nil
+		}
+
+		return s, nil
+	}
+
+	if fieldType == durationType {
+		if _, err := time.ParseDuration(s); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	switch fieldType.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, 64)
+		return int64(v), err
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, 64)
+	case reflect.Slice:
+		return splitEnvList(s), nil
+	default:
+		return s, nil
+	}
+}
+
+func splitEnvList(s string) []interface{} {
+	result := []interface{}{}
+
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// tomlFields returns the types of the fields of a struct by their toml key.
+func tomlFields(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		fields[name] = field.Type
+	}
+
+	return fields
+}
+
+// isPluginMap returns true for types of the form map[string][]*T.
+func isPluginMap(typ reflect.Type) bool {
+	return typ != nil &&
+		typ.Kind() == reflect.Map &&
+		typ.Elem().Kind() == reflect.Slice &&
+		typ.Elem().Elem().Kind() == reflect.Ptr
+}
+
+func envName(key string) string {
+	return strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+func envNamesWithPrefix(env map[string]string, prefix string) []string {
+	var names []string
+	for name := range env {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isClaimed returns true if the name falls within one of the claimed tables.
+func isClaimed(tables map[string]bool, name string) bool {
+	for prefix := range tables {
+		if strings.HasPrefix(name, prefix+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestApplyEnvironment(t *testing.T) {
+	load := func(t *testing.T, content string, env map[string]string) *Config {
+		tree, err := toml.Load(content)
+		require.NoError(t, err)
+		require.NoError(t, applyEnvironment(tree, env))
+		conf, err := FromTree(tree)
+		require.NoError(t, err)
+		return conf
+	}
+
+	t.Run("main", func(t *testing.T) {
+		conf := load(t, ``, map[string]string{
+			"CLOUDSURVEY_MAIN_VERBOSE":  "true",
+			"CLOUDSURVEY_MAIN_INTERVAL": "5m",
+		})
+
+		require.Equal(t, true, conf.Main.Verbose)
+		require.Equal(t, 5*time.Minute, conf.Main.Interval)
+	})
+
+	t.Run("indexed and unindexed plugin entries", func(t *testing.T) {
+		conf := load(t, `
+			[[credentials.aws]]
+			region = "eu-west-1"
+			scopes = ["a"]
+
+			[[credentials.aws]]
+			region = "eu-west-1"
+			`,
+			map[string]string{
+				"CLOUDSURVEY_CREDENTIALS_AWS_REGION":             "us-east-1",
+				"CLOUDSURVEY_CREDENTIALS_AWS_1_REGION":           "eu-north-1",
+				"CLOUDSURVEY_CREDENTIALS_AWS_0_SCOPES":           "b, c",
+				"CLOUDSURVEY_CREDENTIALS_AWS_0_METRIC_TAGS_FOO":  "bar",
+				"CLOUDSURVEY_CREDENTIALS_AWS_1_SHARED_CONFIG":    "false",
+				"CLOUDSURVEY_CREDENTIALS_AWS_1_ROLE_ARN":         "arn:aws:iam::123:role/a",
+				"CLOUDSURVEY_CREDENTIALS_AWS_1_EXTERNAL_ID":      "123",
+				"CLOUDSURVEY_CREDENTIALS_AWS_1_ALLOWED_ACCOUNTS": "1,2",
+			})
+
+		creds := conf.Credentials["aws"]
+		require.Equal(t, "us-east-1", creds[0].tree.Get("region"))
+		require.Equal(t, []string{"b", "c"}, creds[0].Scopes)
+		require.Equal(t, map[string]string{"foo": "bar"}, creds[0].MetricTags)
+		require.Equal(t, "eu-north-1", creds[1].tree.Get("region"))
+		require.Equal(t, false, creds[1].tree.Get("shared_config"))
+		require.Equal(t, "arn:aws:iam::123:role/a", creds[1].tree.Get("role_arn"))
+		require.Equal(t, "123", creds[1].tree.Get("external_id"))
+		require.Equal(t, []interface{}{"1", "2"}, creds[1].tree.Get("allowed_accounts"))
+	})
+
+	t.Run("existing types are kept", func(t *testing.T) {
+		conf := load(t, `
+			[[sources.aws_ce_daily]]
+			metrics = ["AmortizedCost"]
+			timeout = "1s"
+			count = 1
+			`,
+			map[string]string{
+				"CLOUDSURVEY_SOURCES_AWS_CE_DAILY_0_METRICS": "BlendedCost",
+				"CLOUDSURVEY_SOURCES_AWS_CE_DAILY_0_TIMEOUT": "2s",
+				"CLOUDSURVEY_SOURCES_AWS_CE_DAILY_0_COUNT":   "2",
+			})
+
+		source := conf.Sources["aws_ce_daily"][0]
+		require.Equal(t, []interface{}{"BlendedCost"}, source.tree.Get("metrics"))
+		require.Equal(t, 2*time.Second, source.Timeout)
+		require.Equal(t, int64(2), source.tree.Get("count"))
+	})
+
+	t.Run("plugins sharing a prefix", func(t *testing.T) {
+		conf := load(t, `
+			[[sources.aws_ec2]]
+			[[sources.aws_ec2_instances]]
+			`,
+			map[string]string{
+				"CLOUDSURVEY_SOURCES_AWS_EC2_INSTANCES_IGNORE_IMAGE_DETAILS": "true",
+			})
+
+		require.Nil(t, conf.Sources["aws_ec2"][0].tree.Get("instances_ignore_image_details"))
+		require.Equal(t, true, conf.Sources["aws_ec2_instances"][0].tree.Get("ignore_image_details"))
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		tree, err := toml.Load(`
+			[main]
+			verbose = false
+			`)
+		require.NoError(t, err)
+
+		err = applyEnvironment(tree, map[string]string{"CLOUDSURVEY_MAIN_VERBOSE": "maybe"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "CLOUDSURVEY_MAIN_VERBOSE")
+
+		err = applyEnvironment(tree, map[string]string{"CLOUDSURVEY_MAIN_INTERVAL": "soon"})
+		require.Error(t, err)
+	})
+}
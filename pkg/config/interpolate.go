@@ -0,0 +1,206 @@
+package config
+
+import (
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// FilePrefix marks a string value as the path of a file to be read in its
+	// place, e.g. "file:/run/secrets/aws_secret_access_key".
+	FilePrefix = "file:"
+
+	// FileKeySuffix marks a key as holding the path of a file, whose contents
+	// become the value of the key without the suffix. For example,
+	// secret_access_key_file sets secret_access_key.
+	FileKeySuffix = "_file"
+)
+
+type lookupFunc func(name string) (string, bool)
+
+// Interpolate expands references to environment variables and files in all
+// string values of the tree, including the options of plugins:
+//
+//   - ${VAR} is replaced by the value of the environment variable VAR, which
+//     must be set, and ${VAR:-default} falls back to default if VAR is unset
+//     or empty. $${ is an escaped ${.
+//   - a value starting with file: is replaced by the contents of the file.
+//   - a key ending in _file is replaced by the key without the suffix, with
+//     the contents of the file as its value.
+//
+// Trailing newlines are removed from the contents of files.
+func Interpolate(tree *toml.Tree) error {
+	return interpolateTree(tree, "", os.LookupEnv)
+}
+
+func interpolateTree(tree *toml.Tree, path string, lookup lookupFunc) error {
+	keys := tree.Keys()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := joinPath(path, key)
+
+		switch v := tree.GetPath([]string{key}).(type) {
+		case *toml.Tree:
+			if err := interpolateTree(v, keyPath, lookup); err != nil {
+				return err
+			}
+		case []*toml.Tree:
+			for i, sub := range v {
+				if err := interpolateTree(sub, fmt.Sprintf("%s[%d]", keyPath, i), lookup); err != nil {
+					return err
+				}
+			}
+		case string:
+			s, err := interpolateString(v, lookup)
+			if err != nil {
+				return errors.Wrap(err, keyPath)
+			}
+
+			if s != v {
+				tree.SetPath([]string{key}, s)
+			}
+		case []interface{}:
+			for i := range v {
+				if s, ok := v[i].(string); ok {
+					s, err := interpolateString(s, lookup)
+					if err != nil {
+						return errors.Wrapf(err, "%s[%d]", keyPath, i)
+					}
+
+					v[i] = s
+				}
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if !strings.HasSuffix(key, FileKeySuffix) || key == FileKeySuffix {
+			continue
+		}
+
+		filename, ok := tree.GetPath([]string{key}).(string)
+		if !ok {
+			continue
+		}
+
+		target := strings.TrimSuffix(key, FileKeySuffix)
+		if tree.HasPath([]string{target}) {
+			return errors.Errorf(
+				"%s: conflicts with %s", joinPath(path, key), joinPath(path, target))
+		}
+
+		s, err := readFileValue(filename)
+		if err != nil {
+			return errors.Wrap(err, joinPath(path, key))
+		}
+
+		tree.SetPath([]string{target}, s)
+		if err := tree.DeletePath([]string{key}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func interpolateString(s string, lookup lookupFunc) (string, error) {
+	if strings.Contains(s, "${") {
+		var err error
+		if s, err = expandVariables(s, lookup); err != nil {
+			return "", err
+		}
+	}
+
+	if strings.HasPrefix(s, FilePrefix) {
+		return readFileValue(strings.TrimPrefix(s, FilePrefix))
+	}
+
+	return s, nil
+}
+
+func expandVariables(s string, lookup lookupFunc) (string, error) {
+	var sb strings.Builder
+
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+
+		if i > 0 && s[i-1] == '$' {
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		sb.WriteString(s[:i])
+		s = s[i+2:]
+
+		j := strings.IndexByte(s, '}')
+		if j < 0 {
+			return "", errors.New("unterminated variable reference")
+		}
+
+		name, def, hasDefault := s[:j], "", false
+		if k := strings.Index(name, ":-"); k >= 0 {
+			name, def, hasDefault = name[:k], name[k+2:], true
+		}
+
+		if !isVariableName(name) {
+			return "", errors.Errorf("invalid variable name: %q", name)
+		}
+
+		value, ok := lookup(name)
+		switch {
+		case hasDefault && value == "":
+			value = def
+		case !ok:
+			return "", errors.Errorf("environment variable not set: %s", name)
+		}
+
+		sb.WriteString(value)
+		s = s[j+1:]
+	}
+}
+
+func isVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func readFileValue(filename string) (string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandVariables(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		v, ok := map[string]string{"A": "a", "EMPTY": ""}[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		input  string
+		expect string
+		err    string
+	}{
+		{"${A}", "a", ""},
+		{"x${A}y${A}z", "xayaz", ""},
+		{"${B:-b}", "b", ""},
+		{"${EMPTY:-b}", "b", ""},
+		{"${A:-b}", "a", ""},
+		{"${EMPTY}", "", ""},
+		{"$${A}", "${A}", ""},
+		{"${B}", "", "environment variable not set: B"},
+		{"${A", "", "unterminated variable reference"},
+		{"${1A}", "", `invalid variable name: "1A"`},
+		{"$1", "$1", ""},
+		{"$${1}_team", "${1}_team", ""},
+		{"${1}", "", `invalid variable name: "1"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			s, err := expandVariables(test.input, lookup)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expect, s)
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudsurvey")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "secret")
+	require.NoError(t, ioutil.WriteFile(secret, []byte("hunter2\n"), 0600))
+
+	lookup := func(name string) (string, bool) {
+		v, ok := map[string]string{"DIR": dir, "REGION": "eu-west-1"}[name]
+		return v, ok
+	}
+
+	t.Run("plugin options", func(t *testing.T) {
+		tree, err := toml.Load(`
+			[[credentials.aws]]
+			region = "${REGION}"
+			access_key_id = "file:${DIR}/secret"
+			secret_access_key_file = "${DIR}/secret"
+			scopes = ["${REGION:-x}", "b"]
+			`)
+		require.NoError(t, err)
+		require.NoError(t, interpolateTree(tree, "", lookup))
+
+		conf, err := FromTree(tree)
+		require.NoError(t, err)
+
+		cred := conf.Credentials["aws"][0]
+		require.Equal(t, "eu-west-1", cred.tree.Get("region"))
+		require.Equal(t, "hunter2", cred.tree.Get("access_key_id"))
+		require.Equal(t, "hunter2", cred.tree.Get("secret_access_key"))
+		require.False(t, cred.tree.Has("secret_access_key_file"))
+		require.Equal(t, []string{"eu-west-1", "b"}, cred.Scopes)
+	})
+
+	t.Run("errors name the key", func(t *testing.T) {
+		tests := []struct {
+			input string
+			err   string
+		}{
+			{
+				`
+				[[sources.aws_iam_users]]
+				name = "${MISSING}"
+				`,
+				"sources.aws_iam_users[0].name: environment variable not set: MISSING",
+			},
+			{
+				`
+				[[credentials.aws]]
+				token = "a"
+				token_file = "b"
+				`,
+				"credentials.aws[0].token_file: conflicts with credentials.aws[0].token",
+			},
+		}
+
+		for _, test := range tests {
+			tree, err := toml.Load(test.input)
+			require.NoError(t, err)
+			require.EqualError(t, interpolateTree(tree, "", lookup), test.err)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ConfigFileExtension is the extension of the files read from a
+// configuration directory.
+const ConfigFileExtension = ".conf"
+
+// FromPaths loads and merges several configuration files. A directory among
+// the paths stands for all of its files with ConfigFileExtension, in lexical
+// order.
+//
+// Arrays of tables, such as [[credentials.aws]] and [[sources.aws_iam_users]],
+// are concatenated in the order of the files. Tables, such as [main], are
+// merged, but a key may only be defined by one file.
+func FromPaths(paths ...string) (*Config, error) {
+	files, err := expandPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := toml.TreeFromMap(map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	origins := make(map[string]origin)
+
+	for _, file := range files {
+		tree, err := toml.LoadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, file)
+		}
+
+		if err := mergeTrees(merged, tree, nil, file, origins); err != nil {
+			return nil, err
+		}
+	}
+
+	return FromTree(merged)
+}
+
+func expandPaths(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, info := range infos {
+			if !info.IsDir() && strings.HasSuffix(info.Name(), ConfigFileExtension) {
+				names = append(names, filepath.Join(path, info.Name()))
+			}
+		}
+
+		sort.Strings(names)
+		files = append(files, names...)
+	}
+
+	return files, nil
+}
+
+// origin is where a key was first defined.
+type origin struct {
+	file     string
+	position toml.Position
+}
+
+func (o origin) String() string {
+	return fmt.Sprintf("%s:%d", o.file, o.position.Line)
+}
+
+// mergeTrees merges src, read from file, into dst. The origins of keys added
+// to dst are recorded, keyed by their dotted path.
+func mergeTrees(dst, src *toml.Tree, path []string, file string, origins map[string]origin) error {
+	keys := src.Keys()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := append(append([]string{}, path...), key)
+		name := strings.Join(keyPath, ".")
+		here := origin{file: file, position: src.GetPositionPath([]string{key})}
+
+		srcValue := src.GetPath([]string{key})
+		dstValue := dst.GetPath([]string{key})
+
+		if dstValue == nil {
+			dst.SetPath([]string{key}, srcValue)
+			origins[name] = here
+
+			if sub, ok := srcValue.(*toml.Tree); ok {
+				recordOrigins(sub, keyPath, file, origins)
+			}
+
+			continue
+		}
+
+		switch s := srcValue.(type) {
+		case *toml.Tree:
+			if d, ok := dstValue.(*toml.Tree); ok {
+				if err := mergeTrees(d, s, keyPath, file, origins); err != nil {
+					return err
+				}
+				continue
+			}
+		case []*toml.Tree:
+			if d, ok := dstValue.([]*toml.Tree); ok {
+				dst.SetPath([]string{key}, append(d, s...))
+				continue
+			}
+		}
+
+		return errors.Errorf(
+			"%s: conflicting key %s (previously defined at %s)", here, name, origins[name])
+	}
+
+	return nil
+}
+
+func recordOrigins(tree *toml.Tree, path []string, file string, origins map[string]origin) {
+	for _, key := range tree.Keys() {
+		keyPath := append(append([]string{}, path...), key)
+		origins[strings.Join(keyPath, ".")] = origin{
+			file:     file,
+			position: tree.GetPositionPath([]string{key}),
+		}
+
+		if sub, ok := tree.GetPath([]string{key}).(*toml.Tree); ok {
+			recordOrigins(sub, keyPath, file, origins)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudsurvey")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	main := write("cloudsurvey.conf", `
+[main]
+verbose = true
+
+[[credentials.aws]]
+name = "root"
+`)
+
+	write("conf.d/b.conf", `
+[[credentials.aws]]
+name = "b"
+
+[[sources.aws_iam_users]]
+scopes = ["b"]
+`)
+
+	write("conf.d/a.conf", `
+[main]
+interval = "5m"
+
+[[credentials.aws]]
+name = "a"
+`)
+
+	write("conf.d/ignored.txt", `
+[main]
+verbose = false
+`)
+
+	t.Run("merge", func(t *testing.T) {
+		conf, err := FromPaths(main, filepath.Join(dir, "conf.d"))
+		require.NoError(t, err)
+
+		require.Equal(t, true, conf.Main.Verbose)
+		require.Equal(t, "5m0s", conf.Main.Interval.String())
+		require.Equal(t, 3, len(conf.Credentials["aws"]))
+		require.Equal(t, "root", conf.Credentials["aws"][0].Name)
+		require.Equal(t, "a", conf.Credentials["aws"][1].Name)
+		require.Equal(t, "b", conf.Credentials["aws"][2].Name)
+		require.Equal(t, "b", conf.Credentials["aws"][2].tree.Get("name"))
+		require.Equal(t, []string{"b"}, conf.Sources["aws_iam_users"][0].Scopes)
+	})
+
+	t.Run("conflicting keys", func(t *testing.T) {
+		conflict := write("conflict.conf", `
+# comment
+
+[main]
+verbose = false
+`)
+
+		_, err := FromPaths(main, conflict)
+		require.EqualError(t, err, conflict+":5: conflicting key main.verbose (previously defined at "+main+":3)")
+	})
+}
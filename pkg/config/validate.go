@@ -0,0 +1,85 @@
+package config
+
+import (
+	"github.com/pelletier/go-toml"
+	"reflect"
+	"sort"
+)
+
+// UnknownKeys returns the keys of the configuration outside of the plugin
+// entries, such as those under [main] and [exporter], that are not known
+// options.
+func (c *Config) UnknownKeys() []string {
+	if c.tree == nil {
+		return nil
+	}
+
+	result := unknownKeys(c.tree, reflect.TypeOf(Config{}), nil)
+
+	if main, ok := c.tree.Get("main").(*toml.Tree); ok {
+		for _, key := range unknownKeys(main, reflect.TypeOf(Main{}), nil) {
+			result = append(result, "main."+key)
+		}
+	}
+
+	if exporter, ok := c.tree.Get("exporter").(*toml.Tree); ok {
+		for _, key := range unknownKeys(exporter, reflect.TypeOf(Exporter{}), nil) {
+			result = append(result, "exporter."+key)
+		}
+	}
+
+	return result
+}
+
+// UnknownKeys returns the keys of the credential configuration that are
+// neither common options, nor options of the given plugin.
+func (c *Credential) UnknownKeys(plugin interface{}) []string {
+	return unknownKeys(c.tree, reflect.TypeOf(Credential{}), plugin)
+}
+
+// UnknownKeys returns the keys of the source configuration that are neither
+// common options, nor options of the given plugin.
+func (s *Source) UnknownKeys(plugin interface{}) []string {
+	return unknownKeys(s.tree, reflect.TypeOf(Source{}), plugin)
+}
+
+// UnknownKeys returns the keys of the processor configuration that are neither
+// common options, nor options of the given plugin.
+func (p *Processor) UnknownKeys(plugin interface{}) []string {
+	return unknownKeys(p.tree, reflect.TypeOf(Processor{}), plugin)
+}
+
+// UnknownKeys returns the keys of the output configuration that are neither
+// common options, nor options of the given plugin.
+func (o *Output) UnknownKeys(plugin interface{}) []string {
+	return unknownKeys(o.tree, reflect.TypeOf(Output{}), plugin)
+}
+
+func unknownKeys(tree *toml.Tree, common reflect.Type, plugin interface{}) []string {
+	if tree == nil {
+		return nil
+	}
+
+	known := tomlFields(common)
+
+	if plugin != nil {
+		typ := reflect.TypeOf(plugin)
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+
+		for key, fieldType := range tomlFields(typ) {
+			known[key] = fieldType
+		}
+	}
+
+	var result []string
+	for _, key := range tree.Keys() {
+		if _, ok := known[key]; !ok {
+			result = append(result, key)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
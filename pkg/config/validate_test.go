@@ -0,0 +1,56 @@
+package config
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUnknownKeys(t *testing.T) {
+	type plugin struct {
+		OmitUserTags bool `toml:"omit_user_tags"`
+		internal     bool
+	}
+
+	conf, err := FromString(`
+		verbose = true
+
+		[main]
+		strict = true
+		interval = "1m"
+		verbos = true
+
+		[exporter]
+		listen = ":9542"
+		stale_grac = "1m"
+
+		[[sources.aws_iam_users]]
+		scopes = ["a"]
+		metric_tags.foo = "bar"
+		omit_user_tags = true
+		omit_user_tag = true
+		internal = true
+		tagexclude = ["user_path"]
+		tagpass.user_path = ["/humans/*"]
+
+		[[processors.rename]]
+		order = 1
+		ordr = 1
+
+		[[outputs.stdout]]
+		namepass = ["aws_*"]
+		tagpass.account = ["a"]
+		nampass = ["aws_*"]
+		`)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"verbose", "main.verbos", "exporter.stale_grac"}, conf.UnknownKeys())
+	require.Equal(t,
+		[]string{"internal", "omit_user_tag"},
+		conf.Sources["aws_iam_users"][0].UnknownKeys(&plugin{}))
+	require.Equal(t, []string{"user_path"}, conf.Sources["aws_iam_users"][0].TagExclude)
+	require.Equal(t, map[string][]string{"user_path": {"/humans/*"}}, conf.Sources["aws_iam_users"][0].TagPass)
+	require.Equal(t, []string{"ordr"}, conf.Processors["rename"][0].UnknownKeys(nil))
+	require.Equal(t, 1, conf.Processors["rename"][0].Order)
+	require.Equal(t, []string{"nampass"}, conf.Outputs["stdout"][0].UnknownKeys(nil))
+	require.Equal(t, map[string][]string{"account": {"a"}}, conf.Outputs["stdout"][0].TagPass)
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"sync"
+	"sync/atomic"
+)
+
+// guardedCollector sends data to a channel until it is closed off, after
+// which any further data is discarded. It protects the channel from sources
+// that have been abandoned after a timeout, but are yet to return.
+type guardedCollector struct {
+	ch     chan<- metric.Datum
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+	count  int64
+}
+
+func newGuardedCollector(ch chan<- metric.Datum) *guardedCollector {
+	return &guardedCollector{
+		ch:   ch,
+		done: make(chan struct{}),
+	}
+}
+
+func (collector *guardedCollector) Record(datum metric.Datum) {
+	collector.mu.RLock()
+	defer collector.mu.RUnlock()
+
+	if collector.closed {
+		return
+	}
+
+	select {
+	case collector.ch <- datum:
+		atomic.AddInt64(&collector.count, 1)
+	case <-collector.done:
+	}
+}
+
+// Count returns the number of data sent to the channel.
+func (collector *guardedCollector) Count() int {
+	return int(atomic.LoadInt64(&collector.count))
+}
+
+// Close unblocks any pending calls to Record, and discards all data recorded
+// from then on. Once Close returns, the channel is no longer written to. Close
+// must only be called once.
+func (collector *guardedCollector) Close() {
+	close(collector.done)
+
+	collector.mu.Lock()
+	collector.closed = true
+	collector.mu.Unlock()
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"sort"
+	"strings"
+)
+
+type credentialEntry struct {
+	plugin string
+	index  int
+	conf   *config.Credential
+}
+
+func (entry *credentialEntry) String() string {
+	return fmt.Sprintf("credentials.%s[%d]", entry.plugin, entry.index)
+}
+
+// orderCredentials returns the enabled credentials such that every credential
+// comes after the one it is configured "from". The order is deterministic:
+// plugins are sorted by name, and credentials of the same plugin keep the
+// order of the configuration wherever their dependencies allow.
+func orderCredentials(credentials map[string][]*config.Credential) ([]*credentialEntry, error) {
+	plugins := make([]string, 0, len(credentials))
+	for plugin := range credentials {
+		plugins = append(plugins, plugin)
+	}
+	sort.Strings(plugins)
+
+	var entries []*credentialEntry
+	byName := make(map[string]*credentialEntry)
+
+	for _, plugin := range plugins {
+		for i, conf := range credentials[plugin] {
+			entry := &credentialEntry{plugin: plugin, index: i, conf: conf}
+			entries = append(entries, entry)
+
+			if conf.Name == "" {
+				continue
+			}
+
+			if other, ok := byName[conf.Name]; ok {
+				return nil, errors.Errorf(
+					"%s: duplicate credential name: %s (also %s)", entry, conf.Name, other)
+			}
+
+			byName[conf.Name] = entry
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[*credentialEntry]int)
+	var result []*credentialEntry
+
+	var visit func(entry *credentialEntry, path []*credentialEntry) error
+	visit = func(entry *credentialEntry, path []*credentialEntry) error {
+		switch state[entry] {
+		case visited:
+			return nil
+		case visiting:
+			return errors.Errorf("credential cycle in from: %s", formatCycle(path, entry))
+		}
+
+		state[entry] = visiting
+
+		if from := entry.conf.From; from != "" {
+			parent, ok := byName[from]
+			if !ok {
+				return errors.Errorf("%s: from: credential not found: %s", entry, from)
+			}
+
+			if parent.conf.Disabled {
+				return errors.Errorf("%s: from: credential is disabled: %s", entry, from)
+			}
+
+			if err := visit(parent, append(path, entry)); err != nil {
+				return err
+			}
+		}
+
+		state[entry] = visited
+		result = append(result, entry)
+		return nil
+	}
+
+	for _, entry := range entries {
+		if entry.conf.Disabled {
+			continue
+		}
+
+		if err := visit(entry, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// formatCycle describes the cycle closed by reaching entry again at the end
+// of path, e.g. "a -> b -> a".
+func formatCycle(path []*credentialEntry, entry *credentialEntry) string {
+	var names []string
+	for i := range path {
+		if path[i] == entry {
+			for _, e := range path[i:] {
+				names = append(names, e.conf.Name)
+			}
+			break
+		}
+	}
+
+	names = append(names, entry.conf.Name)
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"context"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PrometheusContentType is the content type of the text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Exporter collects the Sources of a Runner in the background, and serves the
+// data of their last complete executions in the Prometheus text format.
+type Exporter struct {
+	Runner *Runner
+
+	// StaleGrace is how long the data of a source is still served after its
+	// executions have started to fail.
+	StaleGrace time.Duration
+
+	mu        sync.Mutex
+	snapshots map[*SourceInstance]*snapshot
+}
+
+// snapshot is the data of a source, as of its last successful execution. It
+// is replaced as a whole, and never modified.
+type snapshot struct {
+	data []metric.Datum
+
+	// telemetry is the SourceMetricName datum of the latest execution,
+	// whether it succeeded or not
+	telemetry metric.Datum
+
+	// staleSince is the time of the first failed execution since data was
+	// collected, if any
+	staleSince time.Time
+}
+
+func NewExporter(runner *Runner, staleGrace time.Duration) *Exporter {
+	return &Exporter{
+		Runner:     runner,
+		StaleGrace: staleGrace,
+		snapshots:  make(map[*SourceInstance]*snapshot),
+	}
+}
+
+// Run collects each of the Sources on its own interval, until the context is
+// cancelled.
+func (exp *Exporter) Run(ctx context.Context) error {
+	exp.Runner.schedule(ctx, exp.collect)
+	return nil
+}
+
+// collect executes the source, and replaces its snapshot once the execution
+// is complete. The data of a failed execution is discarded, in favour of that
+// of the last successful one.
+func (exp *Exporter) collect(ctx context.Context, source *SourceInstance) {
+	ch := make(chan metric.Datum, 100)
+	done := make(chan []metric.Datum, 1)
+
+	go func() {
+		var data []metric.Datum
+		for datum := range ch {
+			data = append(data, datum)
+		}
+		done <- data
+	}()
+
+	result := exp.Runner.runSource(ctx, source, ch, time.Time{})
+	close(ch)
+	data := <-done
+
+	// the telemetry datum may not have been sent once the exporter is
+	// stopping, and is otherwise always the last one sent
+	if ctx.Err() != nil || len(data) == 0 {
+		return
+	}
+
+	next := snapshot{telemetry: data[len(data)-1]}
+
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+
+	if prev, ok := exp.snapshots[source]; ok && result.Err != nil {
+		next.data = prev.data
+		next.staleSince = prev.staleSince
+		if next.staleSince.IsZero() {
+			next.staleSince = result.Start
+		}
+	} else if result.Err == nil {
+		next.data = data[:len(data)-1]
+	}
+
+	exp.snapshots[source] = &next
+}
+
+// Data returns the data to be served, in the order of the Sources. The data of
+// sources that have been failing for longer than the StaleGrace is omitted.
+func (exp *Exporter) Data() []metric.Datum {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+
+	var result []metric.Datum
+	now := time.Now()
+
+	for _, source := range exp.Runner.Sources {
+		snap, ok := exp.snapshots[source]
+		if !ok {
+			continue
+		}
+
+		if snap.staleSince.IsZero() || now.Sub(snap.staleSince) <= exp.StaleGrace {
+			result = append(result, snap.data...)
+		}
+
+		result = append(result, snap.telemetry)
+	}
+
+	return result
+}
+
+func (exp *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s, err := metric.ToPrometheusTextFormat(exp.Data())
+	if err != nil {
+		log.Printf("error: exporter: %+v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", PrometheusContentType)
+	_, _ = w.Write([]byte(s))
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExporter(t *testing.T) {
+	conf, err := config.FromString(`
+[[credentials.aws]]
+scopes = ["all"]
+
+[[sources.mock]]
+scopes = ["all"]
+data = 2
+	`)
+	require.NoError(t, err)
+	runner, err := NewRunner(context.Background(), conf)
+	require.NoError(t, err)
+
+	source := runner.Sources[0]
+	plugin := source.Plugin.(*mockSource)
+	exp := NewExporter(runner, time.Hour)
+
+	t.Run("before the first execution", func(t *testing.T) {
+		require.Empty(t, exp.Data())
+	})
+
+	t.Run("successful execution", func(t *testing.T) {
+		exp.collect(context.Background(), source)
+		data := exp.Data()
+		require.Equal(t, 2, len(named("mock", data)))
+		require.Equal(t, 1, len(named(SourceMetricName, data)))
+	})
+
+	t.Run("failed execution", func(t *testing.T) {
+		plugin.Fail = true
+		plugin.Data = 1
+		exp.collect(context.Background(), source)
+
+		// the data of the last successful execution is kept
+		data := exp.Data()
+		require.Equal(t, 2, len(named("mock", data)))
+		require.Equal(t, true, named(SourceMetricName, data)[0].Fields["error"])
+	})
+
+	t.Run("stale data", func(t *testing.T) {
+		exp.StaleGrace = 0
+		time.Sleep(time.Millisecond)
+
+		data := exp.Data()
+		require.Equal(t, 0, len(named("mock", data)))
+		require.Equal(t, 1, len(named(SourceMetricName, data)))
+	})
+
+	t.Run("recovery", func(t *testing.T) {
+		plugin.Fail = false
+		exp.collect(context.Background(), source)
+		require.Equal(t, 1, len(named("mock", exp.Data())))
+	})
+
+	t.Run("serve", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		exp.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, PrometheusContentType, rec.Header().Get("Content-Type"))
+		require.True(t, strings.Contains(rec.Body.String(), "\nmock_i 0\n"))
+		require.True(t, strings.Contains(rec.Body.String(), "\n"+SourceMetricName+"_error{"))
+	})
+}
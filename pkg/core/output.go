@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"golang.org/x/sync/errgroup"
+	"sort"
+)
+
+// OutputBufferSize is the number of data buffered for each output, so that a
+// slow output does not immediately hold back the others.
+const OutputBufferSize = 100
+
+type OutputInstance struct {
+	Name   string
+	Plugin registry.Output
+
+	// Filter selects the data sent to the output.
+	Filter metric.Filter
+}
+
+// Output sends every datum received from the channel to each of the Outputs
+// whose filter selects it, until the channel is closed and the outputs have
+// returned.
+//
+// If an output fails, the others are cancelled, but the channel is drained
+// regardless, so that the sources sending to it are not blocked.
+func (runner *Runner) Output(ctx context.Context, ch <-chan metric.Datum) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	chs := make([]chan metric.Datum, len(runner.Outputs))
+
+	for i, output := range runner.Outputs {
+		i, output := i, output
+		chs[i] = make(chan metric.Datum, OutputBufferSize)
+		eg.Go(func() error {
+			if err := output.Plugin.Output(ctx, chs[i]); err != nil {
+				return errors.Wrapf(err, "output %s", output.Name)
+			}
+
+			return nil
+		})
+	}
+
+	for datum := range ch {
+		for i, out := range chs {
+			if !runner.Outputs[i].Filter.Match(datum) {
+				continue
+			}
+
+			select {
+			case out <- datum:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	for _, out := range chs {
+		close(out)
+	}
+
+	return eg.Wait()
+}
+
+// loadOutputPlugins loads the enabled outputs, or the DefaultOutput if none
+// are configured.
+func (runner *Runner) loadOutputPlugins(outputs map[string][]*config.Output) error {
+	if len(outputs) == 0 {
+		outputs = map[string][]*config.Output{
+			config.DefaultOutput: {&config.Output{}},
+		}
+	}
+
+	for _, pluginName := range sortedKeys(outputs) {
+		for i, pluginConf := range outputs[pluginName] {
+			if pluginConf.Disabled {
+				continue
+			}
+
+			if err := runner.loadOutputPlugin(pluginName, pluginConf); err != nil {
+				return errors.Wrapf(err, "outputs.%s[%d]", pluginName, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (runner *Runner) loadOutputPlugin(name string, conf *config.Output) error {
+	init, err := registry.GetOutput(name)
+	if err != nil {
+		return err
+	}
+
+	it := init()
+	if err := conf.Configure(it); err != nil {
+		return err
+	}
+
+	if resource, ok := it.(registry.ResourceOutput); ok {
+		resource.SetResourceTags(runner.resourceTags())
+	}
+
+	if initializer, ok := it.(registry.Initializer); ok {
+		if err := initializer.Init(); err != nil {
+			return err
+		}
+	}
+
+	runner.Outputs = append(runner.Outputs, &OutputInstance{
+		Name:   name,
+		Plugin: it,
+		Filter: metric.Filter{
+			NamePass: conf.NamePass,
+			NameDrop: conf.NameDrop,
+			TagPass:  conf.TagPass,
+			TagDrop:  conf.TagDrop,
+		},
+	})
+
+	return nil
+}
+
+// resourceTags returns the names of the metric tags of all sessions, in
+// lexical order.
+func (runner *Runner) resourceTags() []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, session := range runner.Sessions {
+		for name := range session.MetricTags {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"testing"
+	"time"
+)
+
+func init() {
+	registry.AddOutput(
+		"mock",
+		func() registry.Output {
+			return &mockOutput{}
+		})
+}
+
+type mockOutput struct {
+	Fail bool `toml:"fail"`
+
+	data         []metric.Datum
+	resourceTags []string
+}
+
+func (plugin *mockOutput) SetResourceTags(names []string) {
+	plugin.resourceTags = names
+}
+
+func (*mockOutput) Description() string {
+	return "keeps mock data"
+}
+
+func (*mockOutput) DefaultConfig() string {
+	return `
+[[outputs.mock]]`
+}
+
+func (plugin *mockOutput) Output(c context.Context, ch <-chan metric.Datum) error {
+	if plugin.Fail {
+		return errors.New("failed")
+	}
+
+	for datum := range ch {
+		plugin.data = append(plugin.data, datum)
+	}
+
+	return nil
+}
+
+func TestRunner_Output(t *testing.T) {
+	initRunner := func(configString string) *Runner {
+		conf, err := config.FromString(configString)
+		require.NoError(t, err)
+		runner, err := NewRunner(context.Background(), conf)
+		require.NoError(t, err)
+		return runner
+	}
+
+	send := func(n int) <-chan metric.Datum {
+		ch := make(chan metric.Datum)
+		go func() {
+			defer close(ch)
+			for i := 0; i < n; i++ {
+				ch <- metric.Datum{Name: "mock", Time: time.Now()}
+			}
+		}()
+		return ch
+	}
+
+	t.Run("default output", func(t *testing.T) {
+		runner := initRunner(``)
+		require.Equal(t, 1, len(runner.Outputs))
+		require.Equal(t, config.DefaultOutput, runner.Outputs[0].Name)
+	})
+
+	t.Run("disabled output", func(t *testing.T) {
+		runner := initRunner(`
+[[outputs.mock]]
+disabled = true
+		`)
+
+		require.Equal(t, 0, len(runner.Outputs))
+	})
+
+	t.Run("resource tags", func(t *testing.T) {
+		runner := initRunner(`
+[[credentials.mock]]
+metric_tags = { account = "a", region = "b" }
+
+[[credentials.mock]]
+metric_tags = { account = "c" }
+
+[[outputs.mock]]
+		`)
+
+		plugin := runner.Outputs[0].Plugin.(*mockOutput)
+		require.Equal(t, []string{"account", "region"}, plugin.resourceTags)
+	})
+
+	t.Run("multiple outputs", func(t *testing.T) {
+		runner := initRunner(`
+[[outputs.mock]]
+
+[[outputs.mock]]
+		`)
+
+		require.Equal(t, 2, len(runner.Outputs))
+		require.NoError(t, runner.Output(context.Background(), send(3*OutputBufferSize)))
+
+		for _, output := range runner.Outputs {
+			require.Equal(t, 3*OutputBufferSize, len(output.Plugin.(*mockOutput).data))
+		}
+	})
+
+	t.Run("routing", func(t *testing.T) {
+		runner := initRunner(`
+[[outputs.mock]]
+namepass = ["aws_iam_*"]
+[outputs.mock.tagpass]
+account = ["team-a-*"]
+
+[[outputs.mock]]
+namedrop = ["aws_iam_*"]
+		`)
+
+		ch := make(chan metric.Datum, 3)
+		ch <- metric.Datum{Name: "aws_iam_user", Tags: map[string]string{"account": "team-a-prod"}}
+		ch <- metric.Datum{Name: "aws_iam_user", Tags: map[string]string{"account": "team-b-prod"}}
+		ch <- metric.Datum{Name: "aws_ec2_instance", Tags: map[string]string{"account": "team-a-prod"}}
+		close(ch)
+
+		require.NoError(t, runner.Output(context.Background(), ch))
+
+		first := runner.Outputs[0].Plugin.(*mockOutput).data
+		require.Equal(t, 1, len(first))
+		require.Equal(t, "team-a-prod", first[0].Tags["account"])
+
+		second := runner.Outputs[1].Plugin.(*mockOutput).data
+		require.Equal(t, 1, len(second))
+		require.Equal(t, "aws_ec2_instance", second[0].Name)
+	})
+
+	t.Run("failing output", func(t *testing.T) {
+		runner := initRunner(`
+[[outputs.mock]]
+
+[[outputs.mock]]
+fail = true
+		`)
+
+		// the channel must be drained even though an output failed
+		err := runner.Output(context.Background(), send(3*OutputBufferSize))
+		require.EqualError(t, err, "output mock: failed")
+	})
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"sort"
+)
+
+type ProcessorInstance struct {
+	Name   string
+	Plugin registry.Processor
+
+	// Filter selects the data processed. Other data pass by unchanged.
+	Filter metric.Filter
+}
+
+// processorCollector passes the data selected by a processor through it, on
+// to the next collector of the chain.
+type processorCollector struct {
+	processor *ProcessorInstance
+	next      metric.Collector
+}
+
+func (collector processorCollector) Record(datum metric.Datum) {
+	if !collector.processor.Filter.Match(datum) {
+		collector.next.Record(datum)
+		return
+	}
+
+	collector.processor.Plugin.Process(datum, collector.next)
+}
+
+// chainProcessors returns a collector that passes data through each of the
+// Processors in turn, and then on to the given collector.
+func (runner *Runner) chainProcessors(collector metric.Collector) metric.Collector {
+	for i := len(runner.Processors) - 1; i >= 0; i-- {
+		collector = processorCollector{processor: runner.Processors[i], next: collector}
+	}
+
+	return collector
+}
+
+// loadProcessorPlugins loads the enabled processors, ordered by their order
+// option, then by plugin name, and then as configured. The position of an
+// entry among several configuration files is not taken into account.
+func (runner *Runner) loadProcessorPlugins(processors map[string][]*config.Processor) error {
+	type entry struct {
+		name  string
+		index int
+		conf  *config.Processor
+	}
+
+	var entries []entry
+	for _, pluginName := range sortedKeys(processors) {
+		for i, pluginConf := range processors[pluginName] {
+			if !pluginConf.Disabled {
+				entries = append(entries, entry{name: pluginName, index: i, conf: pluginConf})
+			}
+		}
+	}
+
+	// entries are already ordered by name and index
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].conf.Order < entries[j].conf.Order
+	})
+
+	for _, entry := range entries {
+		if err := runner.loadProcessorPlugin(entry.name, entry.conf); err != nil {
+			return errors.Wrapf(err, "processors.%s[%d]", entry.name, entry.index)
+		}
+	}
+
+	return nil
+}
+
+func (runner *Runner) loadProcessorPlugin(name string, conf *config.Processor) error {
+	init, err := registry.GetProcessor(name)
+	if err != nil {
+		return err
+	}
+
+	it := init()
+	if err := conf.Configure(it); err != nil {
+		return err
+	}
+
+	if initializer, ok := it.(registry.Initializer); ok {
+		if err := initializer.Init(); err != nil {
+			return err
+		}
+	}
+
+	runner.Processors = append(runner.Processors, &ProcessorInstance{
+		Name:   name,
+		Plugin: it,
+		Filter: metric.Filter{
+			NamePass: conf.NamePass,
+			NameDrop: conf.NameDrop,
+			TagPass:  conf.TagPass,
+			TagDrop:  conf.TagDrop,
+		},
+	})
+
+	return nil
+}
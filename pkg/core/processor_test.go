@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"strings"
+	"testing"
+)
+
+func TestRunner_Processors(t *testing.T) {
+	conf, err := config.FromString(`
+[[credentials.aws]]
+scopes = ["all"]
+metric_tags = { account = "a" }
+
+[[sources.mock]]
+scopes = ["all"]
+data = 2
+
+[[processors.rename]]
+order = 1
+[[processors.rename.replace]]
+measurement = "renamed"
+dest = "final"
+
+[[processors.rename]]
+[[processors.rename.replace]]
+measurement = "mock"
+dest = "renamed"
+
+[[processors.regex]]
+tagpass.account = ["a"]
+[[processors.regex.tags]]
+key = "account"
+pattern = "^a$"
+replacement = "b"
+
+[[processors.drop]]
+namepass = ["other"]
+fields = ["i"]
+
+[[processors.drop]]
+disabled = true
+fields = ["*"]
+		`)
+	require.NoError(t, err)
+
+	runner, err := NewRunner(context.Background(), conf)
+	require.NoError(t, err)
+
+	var names []string
+	for _, processor := range runner.Processors {
+		names = append(names, processor.Name)
+	}
+
+	require.Equal(t, []string{"drop", "regex", "rename", "rename"}, names)
+
+	ch := make(chan metric.Datum)
+	result := drain(ch)
+	require.NoError(t, runner.Run(context.Background(), ch))
+	close(ch)
+
+	data := <-result
+	require.Equal(t, 0, len(named("mock", data)))
+	require.Equal(t, 2, len(named("final", data)))
+
+	for i, datum := range named("final", data) {
+		require.Equal(t, map[string]string{"account": "b"}, datum.Tags)
+		require.Equal(t, map[string]interface{}{"i": i}, datum.Fields)
+	}
+
+	// internal metrics bypass the processors
+	require.Equal(t, "a", named(SourceMetricName, data)[0].Tags["account"])
+}
+
+func TestValidate_processors(t *testing.T) {
+	conf, err := config.FromString(`
+[[processors.drop]]
+field = ["i"]
+
+[[processors.unknown]]
+		`)
+	require.NoError(t, err)
+
+	err = Validate(conf)
+	require.Error(t, err)
+	require.Equal(t, []string{
+		"processors.drop[0]: unknown option: field",
+		"processor plugin not found: unknown",
+	}, err.(*ValidationError).Problems)
+}
+
+// TestProcessors_examples loads the default configuration of every processor,
+// with its examples enabled, the way a user would.
+func TestProcessors_examples(t *testing.T) {
+	for _, name := range registry.ListProcessors() {
+		init, err := registry.GetProcessor(name)
+		require.NoError(t, err)
+
+		snippet := uncomment(init().DefaultConfig())
+		conf, err := config.FromString("[main]\nstrict = true\n" + snippet)
+		require.NoError(t, err, snippet)
+
+		_, err = NewRunner(context.Background(), conf)
+		require.NoError(t, err, snippet)
+	}
+
+	t.Run("regex", func(t *testing.T) {
+		init, err := registry.GetProcessor("regex")
+		require.NoError(t, err)
+
+		conf, err := config.FromString(uncomment(init().DefaultConfig()))
+		require.NoError(t, err)
+
+		runner, err := NewRunner(context.Background(), conf)
+		require.NoError(t, err)
+
+		ch := make(chan metric.Datum, 1)
+		runner.Processors[0].Plugin.Process(metric.Datum{
+			Name: "aws_iam_user",
+			Tags: map[string]string{"user_path": "/ops/admins/"},
+		}, metric.ChannelCollector(ch))
+		require.Equal(t, "ops", (<-ch).Tags["team"])
+	})
+}
+
+// uncomment enables the options commented out in a default configuration,
+// leaving the comments that start with ##.
+func uncomment(snippet string) string {
+	lines := strings.Split(snippet, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "# ") && !strings.HasPrefix(line, "## ") {
+			lines[i] = strings.TrimPrefix(line, "# ")
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
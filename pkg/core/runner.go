@@ -8,27 +8,45 @@ import (
 	"github.com/tetratom/cloudsurvey/pkg/metric"
 	"github.com/tetratom/cloudsurvey/pkg/registry"
 	_ "github.com/tetratom/cloudsurvey/plugins"
-	"golang.org/x/sync/errgroup"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 func NewRunner(ctx context.Context, conf *config.Config) (*Runner, error) {
 	var runner Runner
 
-	for pluginName, pluginConfs := range conf.Credentials {
-		for _, pluginConf := range pluginConfs {
-			if pluginConf.Disabled {
-				continue
-			}
+	runner.Interval = conf.Main.Interval
+	if runner.Interval == 0 {
+		runner.Interval = config.DefaultInterval
+	}
 
-			if err := runner.loadCredentialPlugin(ctx, pluginName, pluginConf); err != nil {
-				return nil, err
-			}
+	runner.RunTimeout = conf.Main.RunTimeout
+
+	if conf.Main.Strict {
+		if err := Validate(conf); err != nil {
+			return nil, err
+		}
+	}
+
+	if problems := intervalProblems(conf); len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	credentials, err := orderCredentials(conf.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range credentials {
+		if err := runner.loadCredentialPlugin(ctx, entry.plugin, entry.conf); err != nil {
+			return nil, errors.Wrap(err, entry.String())
 		}
 	}
 
-	for pluginName, pluginConfs := range conf.Sources {
-		for _, pluginConf := range pluginConfs {
+	for _, pluginName := range sortedKeys(conf.Sources) {
+		for _, pluginConf := range conf.Sources[pluginName] {
 			if pluginConf.Disabled {
 				continue
 			}
@@ -39,12 +57,33 @@ func NewRunner(ctx context.Context, conf *config.Config) (*Runner, error) {
 		}
 	}
 
+	if err := runner.loadProcessorPlugins(conf.Processors); err != nil {
+		return nil, err
+	}
+
+	if err := runner.loadOutputPlugins(conf.Outputs); err != nil {
+		return nil, err
+	}
+
 	return &runner, nil
 }
 
 type Runner struct {
-	Sessions []*SessionInstance
-	Sources  []*SourceInstance
+	Sessions   []*SessionInstance
+	Sources    []*SourceInstance
+	Processors []*ProcessorInstance
+	Outputs    []*OutputInstance
+
+	// Interval is the default collection interval in daemon mode, used by
+	// sources that do not configure their own.
+	Interval time.Duration
+
+	// RunTimeout, if set, is the deadline for all sources to complete in Run.
+	RunTimeout time.Duration
+
+	// Report, if set, is invoked with the result of every source execution.
+	// It may be invoked concurrently.
+	Report func(Result)
 }
 
 type SessionInstance struct {
@@ -56,32 +95,213 @@ type SessionInstance struct {
 
 type SourceInstance struct {
 	Name       string
+	Session    string
 	MetricTags map[string]string
+	Interval   time.Duration
+	Timeout    time.Duration
 	Plugin     registry.Source
+
+	// Filter selects and limits the data of the source, before the metric
+	// tags are applied.
+	Filter metric.Filter
+
+	// running is set while the plugin is executing, which may outlast the
+	// execution that started it, if the plugin was abandoned after a timeout
+	running int32
+}
+
+// Result describes a single execution of a SourceInstance.
+type Result struct {
+	Source   *SourceInstance
+	Start    time.Time
+	Duration time.Duration
+	Count    int
+	Err      error
 }
 
+// ErrTimeout is the cause of the error reported for a source that did not
+// return before its deadline.
+var ErrTimeout = errors.New("source timed out")
+
+// ErrStillRunning is the cause of the error reported for an execution that was
+// skipped, because the plugin had not yet returned from an abandoned one.
+var ErrStillRunning = errors.New("source still running")
+
 // Run configures all plugins and runs the Sources. Metrics are sent to the
 // given channel. The channel is _not_ closed by Run.
+//
+// Sources that exceed their timeout, or the RunTimeout, are abandoned and
+// reported as failed, so that they do not hold back the others. Each
+// execution is reported by a SourceMetricName datum, and the run as a whole
+// by a RunMetricName datum. Once the context is cancelled, Run returns without
+// waiting for the channel to accept any more data.
 func (runner *Runner) Run(ctx context.Context, ch chan<- metric.Datum) error {
-	eg, ctx := errgroup.WithContext(ctx)
+	start := time.Now()
+
+	var deadline time.Time
+	if runner.RunTimeout > 0 {
+		deadline = start.Add(runner.RunTimeout)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]Result, len(runner.Sources))
+
+	for i, source := range runner.Sources {
+		i, source := i, source
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runner.runSource(ctx, source, ch, deadline)
+		}()
+	}
+
+	wg.Wait()
+
+	select {
+	case ch <- runDatum(start, results):
+	case <-ctx.Done():
+	}
+
+	return nil
+}
+
+// Daemon runs each of the Sources immediately, and then repeatedly on its
+// own interval until the context is cancelled. The plugins and sessions are
+// reused between executions, each of which is reported by a SourceMetricName
+// datum. The channel is _not_ closed by Daemon.
+func (runner *Runner) Daemon(ctx context.Context, ch chan<- metric.Datum) error {
+	runner.schedule(ctx, func(ctx context.Context, source *SourceInstance) {
+		runner.runSource(ctx, source, ch, time.Time{})
+	})
+
+	return nil
+}
+
+// schedule invokes fn for each of the Sources immediately, and then
+// repeatedly on the interval of the source until the context is cancelled.
+// Invocations of fn for the same source never overlap, though a plugin that
+// was abandoned by runSource may still be running. Returns once all
+// invocations have returned.
+func (runner *Runner) schedule(ctx context.Context, fn func(context.Context, *SourceInstance)) {
+	var wg sync.WaitGroup
 
 	for _, source := range runner.Sources {
 		source := source
-		eg.Go(func() error {
-			collector := metric.MetricTagOverrideCollector{
-				Inner:      metric.ChannelCollector(ch),
-				MetricTags: source.MetricTags,
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ticker := time.NewTicker(source.Interval)
+			defer ticker.Stop()
+
+			for {
+				fn(ctx, source)
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
 			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// runSource executes the source until it returns, or until its timeout or the
+// deadline, if not zero, has passed. The result is reported unless the context
+// is cancelled first.
+func (runner *Runner) runSource(ctx context.Context, source *SourceInstance, ch chan<- metric.Datum, deadline time.Time) Result {
+	result := Result{Source: source, Start: time.Now()}
+
+	// the result is reported even if the execution ran out of time, so the
+	// deadlines only apply to the context of the execution
+	execCtx := ctx
 
-			if err := source.Plugin.Source(ctx, collector); err != nil {
-				log.Printf("error: source %s: %+v", source.Name, err)
+	if source.Timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(execCtx, source.Timeout)
+		defer cancel()
+	}
+
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithDeadline(execCtx, deadline)
+		defer cancel()
+	}
+
+	// a plugin abandoned after a timeout must not be executed concurrently,
+	// so the execution is skipped until it returns
+	if !atomic.CompareAndSwapInt32(&source.running, 0, 1) {
+		result.Err = ErrStillRunning
+		runner.report(ctx, result, ch)
+		return result
+	}
+
+	guard := newGuardedCollector(ch)
+
+	// the processors see the data with the metric tags applied
+	collector := metric.FilterCollector{
+		Inner: metric.MetricTagOverrideCollector{
+			Inner:      runner.chainProcessors(guard),
+			MetricTags: source.MetricTags,
+		},
+		Filter: source.Filter,
+	}
+
+	// the source runs in its own goroutine, so that a plugin which does not
+	// respect the context cannot block the runner past its deadline
+	done := make(chan error, 1)
+	go func() {
+		err := source.Plugin.Source(execCtx, collector)
+		atomic.StoreInt32(&source.running, 0)
+		done <- err
+	}()
+
+	select {
+	case result.Err = <-done:
+	case <-execCtx.Done():
+		select {
+		case result.Err = <-done:
+		default:
+			if execCtx.Err() == context.DeadlineExceeded {
+				result.Err = ErrTimeout
+			} else {
+				result.Err = execCtx.Err()
 			}
+		}
+	}
 
-			return nil
-		})
+	result.Duration = time.Since(result.Start)
+	guard.Close()
+	result.Count = guard.Count()
+	runner.report(ctx, result, ch)
+	return result
+}
+
+// report sends the SourceMetricName datum of the execution, unless the
+// context is cancelled first, logs its error, if any, and passes it on to
+// Report.
+func (runner *Runner) report(ctx context.Context, result Result, ch chan<- metric.Datum) {
+	select {
+	case ch <- sourceDatum(result):
+	case <-ctx.Done():
 	}
 
-	return eg.Wait()
+	switch result.Err {
+	case nil:
+	case ErrTimeout:
+		log.Printf("error: source %s: timed out after %s", result.Source.Name, result.Duration)
+	case ErrStillRunning:
+		log.Printf("error: source %s: skipped, as the previous execution is still running", result.Source.Name)
+	default:
+		log.Printf("error: source %s: %+v", result.Source.Name, result.Err)
+	}
+
+	if runner.Report != nil {
+		runner.Report(result)
+	}
 }
 
 func (runner *Runner) getSessionByName(name string) (*SessionInstance, error) {
@@ -165,6 +385,11 @@ func (runner *Runner) loadSourcePlugin(ctx context.Context, name string, conf *c
 		return err
 	}
 
+	interval := conf.Interval
+	if interval == 0 {
+		interval = runner.Interval
+	}
+
 	for _, scope := range conf.Scopes {
 		sessions, err := runner.getSessionsByScope(scope)
 		if err != nil {
@@ -186,8 +411,21 @@ func (runner *Runner) loadSourcePlugin(ctx context.Context, name string, conf *c
 
 			runner.Sources = append(runner.Sources, &SourceInstance{
 				Name:       name,
+				Session:    session.Name,
 				MetricTags: util.MergeStringMaps(session.MetricTags, conf.MetricTags),
+				Interval:   interval,
+				Timeout:    conf.Timeout,
 				Plugin:     it,
+				Filter: metric.Filter{
+					NamePass:   conf.NamePass,
+					NameDrop:   conf.NameDrop,
+					TagPass:    conf.TagPass,
+					TagDrop:    conf.TagDrop,
+					FieldPass:  conf.FieldPass,
+					FieldDrop:  conf.FieldDrop,
+					TagInclude: conf.TagInclude,
+					TagExclude: conf.TagExclude,
+				},
 			})
 		}
 	}
@@ -2,12 +2,128 @@ package core
 
 import (
 	"context"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
 	"github.com/tetratom/cloudsurvey/plugins/source/aws/iam"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+func init() {
+	registry.AddCredentials(
+		"mock",
+		func(cred registry.Session) registry.Credentials {
+			x := mockCredentials{}
+			if cred != nil {
+				x.from = cred.(*session.Session)
+			}
+			return &x
+		})
+
+	registry.AddSource(
+		"mock",
+		func(registry.Session) registry.Source {
+			return &mockSource{}
+		})
+}
+
+// mockCredentials passes on its parent session, so that it can be chained with
+// the aws credentials plugin.
+type mockCredentials struct {
+	from *session.Session
+}
+
+func (*mockCredentials) Description() string {
+	return "provides mock sessions"
+}
+
+func (*mockCredentials) DefaultConfig() string {
+	return `
+[[credentials.mock]]`
+}
+
+func (plugin *mockCredentials) Credentials(context.Context) (registry.Session, error) {
+	if plugin.from != nil {
+		return plugin.from, nil
+	}
+
+	return session.NewSession()
+}
+
+type mockSource struct {
+	Data  int           `toml:"data"`
+	Sleep time.Duration `toml:"sleep"`
+	Fail  bool          `toml:"fail"`
+
+	runs     int32
+	active   int32
+	overlaps int32
+}
+
+func (*mockSource) Description() string {
+	return "produces mock data"
+}
+
+func (*mockSource) DefaultConfig() string {
+	return `
+[[sources.mock]]
+data = 1`
+}
+
+func (plugin *mockSource) Source(c context.Context, collector metric.Collector) error {
+	atomic.AddInt32(&plugin.runs, 1)
+	if atomic.AddInt32(&plugin.active, 1) > 1 {
+		atomic.AddInt32(&plugin.overlaps, 1)
+	}
+	defer atomic.AddInt32(&plugin.active, -1)
+
+	// deliberately ignores the context, like a hung api call would
+	time.Sleep(plugin.Sleep)
+
+	for i := 0; i < plugin.Data; i++ {
+		collector.Record(metric.Datum{
+			Name:   "mock",
+			Time:   time.Now(),
+			Fields: map[string]interface{}{"i": i},
+		})
+	}
+
+	if plugin.Fail {
+		return errors.New("failed")
+	}
+
+	return nil
+}
+
+func named(name string, data []metric.Datum) []metric.Datum {
+	var result []metric.Datum
+	for _, datum := range data {
+		if datum.Name == name {
+			result = append(result, datum)
+		}
+	}
+	return result
+}
+
+func drain(ch <-chan metric.Datum) <-chan []metric.Datum {
+	result := make(chan []metric.Datum, 1)
+
+	go func() {
+		var data []metric.Datum
+		for datum := range ch {
+			data = append(data, datum)
+		}
+		result <- data
+	}()
+
+	return result
+}
+
 func TestNewRunner(t *testing.T) {
 	initRunner := func(configString string) *Runner {
 		conf, err := config.FromString(configString)
@@ -34,6 +150,95 @@ profile = "bar"
 		require.Equal(t, "", runner.Sessions[1].Name)
 	})
 
+	t.Run("dependencies across plugins", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			runner := initRunner(`
+[[credentials.aws]]
+name = "c"
+from = "b"
+
+[[credentials.aws]]
+name = "a"
+
+[[credentials.mock]]
+name = "b"
+from = "a"
+
+[[credentials.mock]]
+name = "d"
+			`)
+
+			var names []string
+			for _, session := range runner.Sessions {
+				names = append(names, session.Name)
+			}
+
+			require.Equal(t, []string{"a", "b", "c", "d"}, names)
+		}
+	})
+
+	t.Run("invalid dependencies", func(t *testing.T) {
+		tests := []struct {
+			config string
+			expect string
+		}{
+			{
+				`
+[[credentials.aws]]
+name = "a"
+from = "c"
+
+[[credentials.mock]]
+name = "b"
+from = "a"
+
+[[credentials.mock]]
+name = "c"
+from = "b"
+				`,
+				"credential cycle in from: a -> c -> b -> a",
+			},
+			{
+				`
+[[credentials.aws]]
+name = "a"
+
+[[credentials.mock]]
+name = "a"
+				`,
+				"credentials.mock[0]: duplicate credential name: a (also credentials.aws[0])",
+			},
+			{
+				`
+[[credentials.aws]]
+name = "a"
+from = "z"
+				`,
+				"credentials.aws[0]: from: credential not found: z",
+			},
+			{
+				`
+[[credentials.aws]]
+name = "a"
+disabled = true
+
+[[credentials.aws]]
+from = "a"
+				`,
+				"credentials.aws[1]: from: credential is disabled: a",
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.expect, func(t *testing.T) {
+				conf, err := config.FromString(test.config)
+				require.NoError(t, err)
+				_, err = NewRunner(context.Background(), conf)
+				require.EqualError(t, err, test.expect)
+			})
+		}
+	})
+
 	t.Run("load source plugin for all sessions in scope", func(t *testing.T) {
 		runner := initRunner(`
 [[credentials.aws]]
@@ -62,3 +267,232 @@ omit_user_tags = true
 		require.Equal(t, true, runner.Sources[1].Plugin.(*iam.Users).OmitUserTags)
 	})
 }
+
+func TestRunner_Daemon(t *testing.T) {
+	t.Run("source intervals", func(t *testing.T) {
+		conf, err := config.FromString(`
+[main]
+interval = "5m"
+
+[[credentials.aws]]
+scopes = ["all"]
+
+[[sources.mock]]
+scopes = ["all"]
+interval = "30s"
+
+[[sources.mock]]
+scopes = ["all"]
+		`)
+		require.NoError(t, err)
+		runner, err := NewRunner(context.Background(), conf)
+		require.NoError(t, err)
+
+		require.Equal(t, 2, len(runner.Sources))
+		require.Equal(t, 30*time.Second, runner.Sources[0].Interval)
+		require.Equal(t, 5*time.Minute, runner.Sources[1].Interval)
+	})
+
+	t.Run("repeated executions reuse the plugin", func(t *testing.T) {
+		conf, err := config.FromString(`
+[[credentials.aws]]
+scopes = ["all"]
+
+[[sources.mock]]
+scopes = ["all"]
+interval = "10ms"
+data = 1
+		`)
+		require.NoError(t, err)
+		runner, err := NewRunner(context.Background(), conf)
+		require.NoError(t, err)
+		require.Equal(t, config.DefaultInterval, runner.Interval)
+
+		c, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		ch := make(chan metric.Datum)
+		result := drain(ch)
+		require.NoError(t, runner.Daemon(c, ch))
+		close(ch)
+
+		// the execution in flight on cancellation may not deliver its data,
+		// nor be reported
+		runs := atomic.LoadInt32(&runner.Sources[0].Plugin.(*mockSource).runs)
+		require.True(t, runs >= 2)
+		data := <-result
+		require.True(t, len(named("mock", data)) >= int(runs)-1)
+		require.True(t, len(named(SourceMetricName, data)) >= int(runs)-1)
+	})
+
+	t.Run("abandoned executions do not overlap", func(t *testing.T) {
+		conf, err := config.FromString(`
+[[credentials.aws]]
+scopes = ["all"]
+
+[[sources.mock]]
+scopes = ["all"]
+interval = "10ms"
+timeout = "10ms"
+sleep = "100ms"
+data = 1
+		`)
+		require.NoError(t, err)
+		runner, err := NewRunner(context.Background(), conf)
+		require.NoError(t, err)
+		plugin := runner.Sources[0].Plugin.(*mockSource)
+
+		c, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+		defer cancel()
+
+		ch := make(chan metric.Datum)
+		result := drain(ch)
+		require.NoError(t, runner.Daemon(c, ch))
+		close(ch)
+
+		// let the last abandoned execution return
+		time.Sleep(150 * time.Millisecond)
+		require.Equal(t, int32(0), atomic.LoadInt32(&plugin.overlaps))
+
+		runs := atomic.LoadInt32(&plugin.runs)
+		require.True(t, runs >= 2 && runs <= 3, "runs: %d", runs)
+
+		var skipped int
+		for _, datum := range named(SourceMetricName, <-result) {
+			if datum.Fields["error_class"] == "still_running" {
+				skipped++
+			}
+		}
+		require.True(t, skipped > 0)
+	})
+}
+
+func TestRunner_Run(t *testing.T) {
+	initRunner := func(configString string) *Runner {
+		conf, err := config.FromString(configString)
+		require.NoError(t, err)
+		runner, err := NewRunner(context.Background(), conf)
+		require.NoError(t, err)
+		return runner
+	}
+
+	t.Run("source timeout", func(t *testing.T) {
+		runner := initRunner(`
+[[credentials.aws]]
+scopes = ["all"]
+
+[[sources.mock]]
+scopes = ["all"]
+data = 1
+sleep = "200ms"
+timeout = "20ms"
+
+[[sources.mock]]
+scopes = ["all"]
+data = 2
+		`)
+
+		require.Equal(t, 20*time.Millisecond, runner.Sources[0].Timeout)
+
+		ch := make(chan metric.Datum)
+		result := drain(ch)
+		start := time.Now()
+		require.NoError(t, runner.Run(context.Background(), ch))
+		require.True(t, time.Since(start) < 150*time.Millisecond)
+		close(ch)
+
+		data := <-result
+		require.Equal(t, 2, len(named("mock", data)))
+		require.Equal(t, 2, len(named(SourceMetricName, data)))
+		require.Equal(t, 1, len(named(RunMetricName, data)))
+		require.Equal(t, 1, named(RunMetricName, data)[0].Fields["errors"])
+		require.Equal(t, 2, named(RunMetricName, data)[0].Fields["data"])
+
+		// the abandoned source must not write to the closed channel
+		time.Sleep(250 * time.Millisecond)
+	})
+
+	t.Run("run timeout", func(t *testing.T) {
+		runner := initRunner(`
+[main]
+run_timeout = "20ms"
+
+[[credentials.aws]]
+scopes = ["all"]
+
+[[sources.mock]]
+scopes = ["all"]
+data = 1
+sleep = "200ms"
+		`)
+
+		require.Equal(t, 20*time.Millisecond, runner.RunTimeout)
+
+		ch := make(chan metric.Datum)
+		result := drain(ch)
+		start := time.Now()
+		require.NoError(t, runner.Run(context.Background(), ch))
+		require.True(t, time.Since(start) < 150*time.Millisecond)
+		close(ch)
+		require.Equal(t, 0, len(named("mock", <-result)))
+	})
+
+	t.Run("source filter", func(t *testing.T) {
+		runner := initRunner(`
+[[credentials.aws]]
+scopes = ["all"]
+metric_tags = { account = "a" }
+
+[[sources.mock]]
+scopes = ["all"]
+data = 2
+fielddrop = ["i"]
+
+[[sources.mock]]
+scopes = ["all"]
+data = 2
+taginclude = ["none"]
+		`)
+
+		ch := make(chan metric.Datum)
+		result := drain(ch)
+		require.NoError(t, runner.Run(context.Background(), ch))
+		close(ch)
+
+		data := <-result
+		require.Equal(t, 2, len(named("mock", data)))
+		require.Equal(t, 2, named(RunMetricName, data)[0].Fields["data"])
+
+		// the metric tags are applied after the filter
+		for _, datum := range named("mock", data) {
+			require.Equal(t, map[string]string{"account": "a"}, datum.Tags)
+		}
+	})
+
+	t.Run("cancelled without a reader", func(t *testing.T) {
+		runner := initRunner(`
+[[credentials.aws]]
+scopes = ["all"]
+
+[[sources.mock]]
+scopes = ["all"]
+data = 1
+		`)
+
+		c, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		// nothing reads the channel, as with a stalled output
+		done := make(chan error, 1)
+		go func() {
+			done <- runner.Run(c, make(chan metric.Datum))
+		}()
+
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after cancellation")
+		}
+	})
+}
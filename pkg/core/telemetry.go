@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/internal/util"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"time"
+)
+
+const (
+	// SourceMetricName is the name of the datum produced by the runner for
+	// every execution of a source.
+	SourceMetricName = "cloudsurvey_source"
+
+	// RunMetricName is the name of the datum produced by the runner at the
+	// end of Run, summarising all executions.
+	RunMetricName = "cloudsurvey_run"
+)
+
+func sourceDatum(result Result) metric.Datum {
+	d := metric.Datum{
+		Name: SourceMetricName,
+		Time: result.Start,
+		Tags: util.MergeStringMaps(result.Source.MetricTags),
+		Fields: map[string]interface{}{
+			"duration": result.Duration,
+			"data":     result.Count,
+			"error":    result.Err != nil,
+		},
+	}
+
+	d.Tags["source"] = result.Source.Name
+
+	if result.Source.Session != "" {
+		d.Tags["session"] = result.Source.Session
+	}
+
+	if result.Err != nil {
+		d.Fields["error_class"] = errorClass(result.Err)
+	}
+
+	return d
+}
+
+func runDatum(start time.Time, results []Result) metric.Datum {
+	var count, errorCount int
+	for _, result := range results {
+		count += result.Count
+		if result.Err != nil {
+			errorCount++
+		}
+	}
+
+	return metric.Datum{
+		Name: RunMetricName,
+		Time: start,
+		Tags: map[string]string{},
+		Fields: map[string]interface{}{
+			"duration": time.Since(start),
+			"sources":  len(results),
+			"errors":   errorCount,
+			"data":     count,
+		},
+	}
+}
+
+// errorClass returns a short, low-cardinality description of err, suitable
+// for grouping failures. Errors that carry a code, such as those returned by
+// aws-sdk-go, are classified by that code.
+func errorClass(err error) string {
+	cause := errors.Cause(err)
+
+	switch cause {
+	case ErrTimeout:
+		return "timeout"
+	case ErrStillRunning:
+		return "still_running"
+	case context.Canceled:
+		return "canceled"
+	case context.DeadlineExceeded:
+		return "deadline_exceeded"
+	}
+
+	if coded, ok := cause.(interface{ Code() string }); ok && coded.Code() != "" {
+		return coded.Code()
+	}
+
+	return "error"
+}
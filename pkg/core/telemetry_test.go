@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"testing"
+	"time"
+)
+
+func TestSourceDatum(t *testing.T) {
+	start := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	source := SourceInstance{
+		Name:       "aws_iam_users",
+		Session:    "root",
+		MetricTags: map[string]string{"account": "a", "source": "x"},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		d := sourceDatum(Result{Source: &source, Start: start, Duration: time.Second, Count: 3})
+		require.Equal(t, metric.Datum{
+			Name: SourceMetricName,
+			Time: start,
+			Tags: map[string]string{
+				"account": "a",
+				"source":  "aws_iam_users",
+				"session": "root",
+			},
+			Fields: map[string]interface{}{
+				"duration": time.Second,
+				"data":     3,
+				"error":    false,
+			},
+		}, d)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		d := sourceDatum(Result{Source: &source, Start: start, Err: ErrTimeout})
+		require.Equal(t, true, d.Fields["error"])
+		require.Equal(t, "timeout", d.Fields["error_class"])
+	})
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err    error
+		expect string
+	}{
+		{ErrTimeout, "timeout"},
+		{context.Canceled, "canceled"},
+		{errors.Wrap(context.DeadlineExceeded, "wrapped"), "deadline_exceeded"},
+		{awserr.New("AccessDenied", "not allowed", nil), "AccessDenied"},
+		{errors.New("unknown"), "error"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expect, func(t *testing.T) {
+			require.Equal(t, test.expect, errorClass(test.err))
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"fmt"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists every problem found by Validate.
+type ValidationError struct {
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(err.Problems, "; ")
+}
+
+// Validate checks that every option in the configuration is understood by
+// cloudsurvey, or by the plugin it is given to, and that intervals are
+// positive. Unlike NewRunner, it does not
+// initialise any plugins, and checks every entry regardless of its scopes.
+// Disabled entries are skipped.
+func Validate(conf *config.Config) error {
+	var problems []string
+
+	for _, key := range conf.UnknownKeys() {
+		problems = append(problems, fmt.Sprintf("unknown option: %s", key))
+	}
+
+	problems = append(problems, intervalProblems(conf)...)
+
+	for _, name := range sortedKeys(conf.Credentials) {
+		init, err := registry.GetCredentials(name)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+
+		for i, pluginConf := range conf.Credentials[name] {
+			if pluginConf.Disabled {
+				continue
+			}
+
+			for _, key := range pluginConf.UnknownKeys(init(nil)) {
+				problems = append(problems, fmt.Sprintf(
+					"credentials.%s[%d]: unknown option: %s", name, i, key))
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(conf.Sources) {
+		init, err := registry.GetSource(name)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+
+		for i, pluginConf := range conf.Sources[name] {
+			if pluginConf.Disabled {
+				continue
+			}
+
+			for _, key := range pluginConf.UnknownKeys(init(nil)) {
+				problems = append(problems, fmt.Sprintf(
+					"sources.%s[%d]: unknown option: %s", name, i, key))
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(conf.Processors) {
+		init, err := registry.GetProcessor(name)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+
+		for i, pluginConf := range conf.Processors[name] {
+			if pluginConf.Disabled {
+				continue
+			}
+
+			for _, key := range pluginConf.UnknownKeys(init()) {
+				problems = append(problems, fmt.Sprintf(
+					"processors.%s[%d]: unknown option: %s", name, i, key))
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(conf.Outputs) {
+		init, err := registry.GetOutput(name)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+
+		for i, pluginConf := range conf.Outputs[name] {
+			if pluginConf.Disabled {
+				continue
+			}
+
+			for _, key := range pluginConf.UnknownKeys(init()) {
+				problems = append(problems, fmt.Sprintf(
+					"outputs.%s[%d]: unknown option: %s", name, i, key))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// intervalProblems returns a problem for every negative interval, of [main]
+// or of an enabled source, which would otherwise stop daemon mode. An interval
+// of zero stands for the default.
+func intervalProblems(conf *config.Config) []string {
+	var problems []string
+
+	if conf.Main.Interval < 0 {
+		problems = append(problems, fmt.Sprintf(
+			"main.interval: must be positive: %s", conf.Main.Interval))
+	}
+
+	for _, name := range sortedKeys(conf.Sources) {
+		for i, pluginConf := range conf.Sources[name] {
+			if !pluginConf.Disabled && pluginConf.Interval < 0 {
+				problems = append(problems, fmt.Sprintf(
+					"sources.%s[%d].interval: must be positive: %s", name, i, pluginConf.Interval))
+			}
+		}
+	}
+
+	return problems
+}
+
+// sortedKeys returns the plugin names of a map of plugin configurations, such
+// as config.Config.Sources, in lexical order.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/config"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	conf, err := config.FromString(`
+[main]
+strict = true
+
+[[credentials.aws]]
+scopes = ["all"]
+regoin = "eu-west-1"
+
+[[sources.aws_iam_users]]
+scopes = ["none"]
+omit_user_tag = true
+
+[[sources.aws_iam_users]]
+disabled = true
+anything = true
+
+[[sources.mock]]
+scopes = ["all"]
+data = 1
+		`)
+	require.NoError(t, err)
+
+	err = Validate(conf)
+	require.Error(t, err)
+	require.Equal(t, []string{
+		"credentials.aws[0]: unknown option: regoin",
+		"sources.aws_iam_users[0]: unknown option: omit_user_tag",
+	}, err.(*ValidationError).Problems)
+
+	_, err = NewRunner(context.Background(), conf)
+	require.Equal(t, err, Validate(conf))
+}
+
+func TestValidate_intervals(t *testing.T) {
+	conf, err := config.FromString(`
+[main]
+interval = "-1m"
+
+[[credentials.aws]]
+scopes = ["all"]
+
+[[sources.mock]]
+scopes = ["all"]
+interval = "-1s"
+
+[[sources.mock]]
+scopes = ["all"]
+interval = "1s"
+
+[[sources.mock]]
+disabled = true
+interval = "-1s"
+		`)
+	require.NoError(t, err)
+
+	problems := []string{
+		"main.interval: must be positive: -1m0s",
+		"sources.mock[0].interval: must be positive: -1s",
+	}
+
+	err = Validate(conf)
+	require.Error(t, err)
+	require.Equal(t, problems, err.(*ValidationError).Problems)
+
+	// rejected even without strict, as daemon mode would fail on them
+	_, err = NewRunner(context.Background(), conf)
+	require.Error(t, err)
+	require.Equal(t, problems, err.(*ValidationError).Problems)
+}
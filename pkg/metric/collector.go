@@ -32,3 +32,16 @@ func (collector MetricTagOverrideCollector) Record(datum Datum) {
 
 	collector.Inner.Record(datum)
 }
+
+// FilterCollector wraps another Collector, and only passes on the data
+// selected by the Filter, with the fields and tags it excludes removed.
+type FilterCollector struct {
+	Inner  Collector
+	Filter Filter
+}
+
+func (collector FilterCollector) Record(datum Datum) {
+	if collector.Filter.Apply(&datum) {
+		collector.Inner.Record(datum)
+	}
+}
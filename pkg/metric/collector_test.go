@@ -48,3 +48,28 @@ func TestMetricTagOverrideCollector(t *testing.T) {
 		require.Equal(t, test.expect, stash.data[i])
 	}
 }
+
+func TestFilterCollector(t *testing.T) {
+	stash := sliceCollector{}
+	collector := FilterCollector{
+		Inner: &stash,
+		Filter: Filter{
+			TagPass:    map[string][]string{"user_path": {"/humans/*"}},
+			TagExclude: []string{"user_path"},
+		},
+	}
+
+	collector.Record(Datum{
+		Tags:   map[string]string{"user_name": "alice", "user_path": "/humans/ops/"},
+		Fields: map[string]interface{}{"age": 1},
+	})
+	collector.Record(Datum{
+		Tags:   map[string]string{"user_name": "ci", "user_path": "/robots/"},
+		Fields: map[string]interface{}{"age": 1},
+	})
+
+	require.Equal(t, []Datum{{
+		Tags:   map[string]string{"user_name": "alice"},
+		Fields: map[string]interface{}{"age": 1},
+	}}, stash.data)
+}
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/pkg/errors"
+	"io"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,12 +16,203 @@ import (
 var (
 	labelReplacer       = strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ")
 	measurementReplacer = strings.NewReplacer(",", "\\,", " ", "\\ ")
-	stringReplacer      = strings.NewReplacer("\"", "\\\"")
+	stringReplacer      = strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
 )
 
+// WireOptions change how data are encoded in the InfluxDB wire protocol. The
+// zero value encodes timestamps and durations in nanoseconds.
+type WireOptions struct {
+	// Precision is the unit of timestamps, one of time.Second,
+	// time.Millisecond, time.Microsecond or time.Nanosecond. Zero stands
+	// for time.Nanosecond.
+	Precision time.Duration
+
+	// DurationFormat is the representation of time.Duration fields.
+	DurationFormat DurationFormat
+
+	// Unsigned writes unsigned integers with the u suffix, which is
+	// supported by InfluxDB 1.4 and later. Otherwise, they are written as
+	// signed integers, and fail with an *OverflowError if they do not fit.
+	Unsigned bool
+}
+
+// OverflowError is the error of encoding an unsigned integer that does not
+// fit the signed integers of the InfluxDB wire protocol.
+type OverflowError struct {
+	Field string
+	Value uint64
+}
+
+func (err *OverflowError) Error() string {
+	return fmt.Sprintf("field %s: %d overflows a signed integer", err.Field, err.Value)
+}
+
+// DurationFormat is a representation of time.Duration fields.
+type DurationFormat string
+
+const (
+	DurationNanoseconds  DurationFormat = "ns"
+	DurationSeconds      DurationFormat = "s"
+	DurationFloatSeconds DurationFormat = "float_s"
+)
+
+// ParsePrecision returns the unit of timestamps given by the name of an
+// InfluxDB precision: s, ms, us or ns. The empty string stands for ns.
+func ParsePrecision(s string) (time.Duration, error) {
+	switch s {
+	case "s":
+		return time.Second, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "us":
+		return time.Microsecond, nil
+	case "", "ns":
+		return time.Nanosecond, nil
+	default:
+		return 0, errors.Errorf("unknown precision: %s", s)
+	}
+}
+
+// ParseDurationFormat returns the representation of durations of the given
+// name: ns for integer nanoseconds, s for integer seconds, or float_s for
+// fractional seconds. The empty string stands for ns.
+func ParseDurationFormat(s string) (DurationFormat, error) {
+	switch format := DurationFormat(s); format {
+	case "":
+		return DurationNanoseconds, nil
+	case DurationNanoseconds, DurationSeconds, DurationFloatSeconds:
+		return format, nil
+	default:
+		return "", errors.Errorf("unknown duration format: %s", s)
+	}
+}
+
+// Encoder writes data to an io.Writer in a given format, one per line. Its
+// buffers are reused from one datum to the next, so that encoding does not
+// allocate once they have grown to size. An Encoder is not safe for
+// concurrent use.
+type Encoder struct {
+	w      io.Writer
+	format Format
+	wire   wireProtocolEncoder
+	json   jsonEncoder
+
+	// keys is a slice used for sorting tags and fields
+	keys []string
+}
+
+// NewEncoder returns an encoder writing to w. The options apply to the
+// InfluxDB wire protocol only. As every datum is written with a single call,
+// w should normally be buffered.
+func NewEncoder(w io.Writer, format Format, opts WireOptions) *Encoder {
+	enc := &Encoder{w: w, format: format}
+	enc.wire.opts = opts
+	return enc
+}
+
+// Encode writes the datum, followed by a newline. Nothing is written if the
+// datum cannot be encoded.
+func (enc *Encoder) Encode(m Datum) error {
+	buf, err := enc.encode(m)
+	if err != nil {
+		return err
+	}
+
+	_ = buf.WriteByte('\n')
+	_, err = enc.w.Write(buf.Bytes())
+	return err
+}
+
+// encode encodes the datum into the buffer of the encoder of its format,
+// which remains valid until the next call.
+func (enc *Encoder) encode(m Datum) (*bytes.Buffer, error) {
+	switch enc.format {
+	case FormatInfluxDB:
+		return &enc.wire.Buffer, enc.encodeWireProtocol(m)
+	case FormatJSON:
+		return &enc.json.Buffer, enc.encodeJSON(m)
+	default:
+		return nil, errors.Errorf("unknown format: %s", enc.format)
+	}
+}
+
+func (enc *Encoder) encodeWireProtocol(m Datum) error {
+	wire := &enc.wire
+	wire.Reset()
+
+	wire.Measurement(m.Name)
+
+	// ensure tags are ordered lexically
+	for _, k := range enc.sortedTags(m.Tags) {
+		wire.Tag(k, m.Tags[k])
+	}
+
+	// ensure fields are ordered lexically
+	for _, k := range enc.sortedFields(m.Fields) {
+		if err := wire.Field(k, m.Fields[k]); err != nil {
+			return err
+		}
+	}
+
+	wire.Timestamp(m.Time)
+	return nil
+}
+
+func (enc *Encoder) encodeJSON(m Datum) error {
+	object := &enc.json
+	object.Reset()
+
+	object.Begin()
+	object.Name(m.Name)
+	object.Timestamp(m.Time)
+
+	object.key("tags")
+	object.Begin()
+	for _, k := range enc.sortedTags(m.Tags) {
+		object.Tag(k, m.Tags[k])
+	}
+	object.End()
+
+	object.key("fields")
+	object.Begin()
+	for _, k := range enc.sortedFields(m.Fields) {
+		if err := object.Field(k, m.Fields[k]); err != nil {
+			return err
+		}
+	}
+	object.End()
+
+	object.End()
+	return nil
+}
+
+func (enc *Encoder) sortedTags(tags map[string]string) []string {
+	enc.keys = enc.keys[:0]
+	for k := range tags {
+		enc.keys = append(enc.keys, k)
+	}
+
+	sort.Strings(enc.keys)
+	return enc.keys
+}
+
+func (enc *Encoder) sortedFields(fields map[string]interface{}) []string {
+	enc.keys = enc.keys[:0]
+	for k := range fields {
+		enc.keys = append(enc.keys, k)
+	}
+
+	sort.Strings(enc.keys)
+	return enc.keys
+}
+
 type wireProtocolEncoder struct {
 	bytes.Buffer
 	fieldCount int
+	opts       WireOptions
+
+	// num is a scratch buffer for formatting numbers without allocating
+	num []byte
 }
 
 func (enc *wireProtocolEncoder) Measurement(name string) {
@@ -52,34 +246,36 @@ func (enc *wireProtocolEncoder) Field(name string, value interface{}) error {
 
 	switch v := value.(type) {
 	case int:
-		enc.WriteString(strconv.FormatInt(int64(v), 10))
-		enc.WriteByte('i')
+		enc.int(int64(v))
+	case int8:
+		enc.int(int64(v))
+	case int16:
+		enc.int(int64(v))
 	case int32:
-		enc.WriteString(strconv.FormatInt(int64(v), 10))
-		enc.WriteByte('i')
+		enc.int(int64(v))
 	case int64:
-		enc.WriteString(strconv.FormatInt(int64(v), 10))
-		enc.WriteByte('i')
+		enc.int(v)
 	case uint:
-		enc.WriteString(strconv.FormatUint(uint64(v), 10))
-		enc.WriteByte('i')
+		return enc.uint(name, uint64(v))
+	case uint8:
+		return enc.uint(name, uint64(v))
+	case uint16:
+		return enc.uint(name, uint64(v))
 	case uint32:
-		enc.WriteString(strconv.FormatUint(uint64(v), 10))
-		enc.WriteByte('i')
+		return enc.uint(name, uint64(v))
 	case uint64:
-		// TODO: What if the number is out of bounds?
-		enc.WriteString(strconv.FormatUint(uint64(v), 10))
-		enc.WriteByte('i')
+		return enc.uint(name, v)
 	case string:
 		enc.string(v)
 	case time.Time:
-		enc.WriteString(strconv.FormatInt(v.UnixNano(), 10))
+		enc.writeInt(v.UnixNano())
 		enc.WriteByte('i')
 	case time.Duration:
-		enc.WriteString(strconv.FormatInt(v.Nanoseconds(), 10))
-		enc.WriteByte('i')
+		enc.duration(v)
+	case float32:
+		enc.writeFloat(float64(v), 32)
 	case float64:
-		enc.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		enc.writeFloat(v, 64)
 	case bool:
 		if v {
 			enc.WriteByte('t')
@@ -104,12 +300,69 @@ func (enc *wireProtocolEncoder) Field(name string, value interface{}) error {
 	return nil
 }
 
+func (enc *wireProtocolEncoder) int(v int64) {
+	enc.writeInt(v)
+	enc.WriteByte('i')
+}
+
+// uint writes an unsigned integer with the u suffix if enabled, or else as a
+// signed integer, provided that it fits.
+func (enc *wireProtocolEncoder) uint(name string, v uint64) error {
+	if enc.opts.Unsigned {
+		enc.writeUint(v)
+		enc.WriteByte('u')
+		return nil
+	}
+
+	if v > math.MaxInt64 {
+		return &OverflowError{Field: name, Value: v}
+	}
+
+	enc.writeUint(v)
+	enc.WriteByte('i')
+	return nil
+}
+
+func (enc *wireProtocolEncoder) duration(d time.Duration) {
+	switch enc.opts.DurationFormat {
+	case DurationSeconds:
+		enc.writeInt(int64(d / time.Second))
+		enc.WriteByte('i')
+	case DurationFloatSeconds:
+		enc.writeFloat(d.Seconds(), 64)
+	default:
+		enc.writeInt(d.Nanoseconds())
+		enc.WriteByte('i')
+	}
+}
+
 func (enc *wireProtocolEncoder) Timestamp(t time.Time) {
+	ts := t.UnixNano()
+	if enc.opts.Precision > time.Nanosecond {
+		ts /= int64(enc.opts.Precision)
+	}
+
 	enc.WriteByte(' ')
-	enc.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+	enc.writeInt(ts)
 }
 
+// Reset discards the encoded data, but keeps the options.
 func (enc *wireProtocolEncoder) Reset() {
 	enc.Buffer.Reset()
 	enc.fieldCount = 0
 }
+
+func (enc *wireProtocolEncoder) writeInt(v int64) {
+	enc.num = strconv.AppendInt(enc.num[:0], v, 10)
+	_, _ = enc.Write(enc.num)
+}
+
+func (enc *wireProtocolEncoder) writeUint(v uint64) {
+	enc.num = strconv.AppendUint(enc.num[:0], v, 10)
+	_, _ = enc.Write(enc.num)
+}
+
+func (enc *wireProtocolEncoder) writeFloat(v float64, bitSize int) {
+	enc.num = strconv.AppendFloat(enc.num[:0], v, 'f', -1, bitSize)
+	_, _ = enc.Write(enc.num)
+}
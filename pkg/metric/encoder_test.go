@@ -1,7 +1,11 @@
 package metric
 
 import (
+	"bytes"
+	"encoding/json"
 	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math"
 	"testing"
 	"time"
 )
@@ -59,12 +63,19 @@ func TestWireProtocolEncoder_Field(t *testing.T) {
 		{"f", int(1), " f=1i"},
 		{"f", int64(0), " f=0i"},
 		{"f", int64(1), " f=1i"},
+		{"f", int8(-8), " f=-8i"},
+		{"f", int16(-16), " f=-16i"},
+		{"f", uint8(8), " f=8i"},
+		{"f", uint16(16), " f=16i"},
+		{"f", uint64(math.MaxInt64), " f=9223372036854775807i"},
+		{"f", float32(1.1), " f=1.1"},
 		{"f", float64(0.0), " f=0"},
 		{"f", float64(1.0), " f=1"},
 		{"f", float64(1.1), " f=1.1"},
 		{"f", float64(1.5), " f=1.5"},
 		{"f", `test`, ` f="test"`},
 		{"f", `"test"`, ` f="\"test\""`},
+		{"f", `te\st\`, ` f="te\\st\\"`},
 		{"f", true, " f=t"},
 		{"f", false, " f=f"},
 		{"f", 2 * time.Second, " f=2000000000i"},
@@ -80,3 +91,217 @@ func TestWireProtocolEncoder_Field(t *testing.T) {
 		})
 	}
 }
+
+func TestWireProtocolEncoder_Unsigned(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		s string
+	}{
+		{uint(1), " f=1u"},
+		{uint8(8), " f=8u"},
+		{uint16(16), " f=16u"},
+		{uint32(32), " f=32u"},
+		{uint64(math.MaxUint64), " f=18446744073709551615u"},
+		{int64(-1), " f=-1i"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			enc := wireProtocolEncoder{opts: WireOptions{Unsigned: true}}
+			require.NoError(t, enc.Field("f", test.v))
+			require.Equal(t, test.s, enc.String())
+		})
+	}
+
+	t.Run("overflow", func(t *testing.T) {
+		var enc wireProtocolEncoder
+		err := enc.Field("f", uint64(math.MaxInt64)+1)
+		require.EqualError(t, err, "field f: 9223372036854775808 overflows a signed integer")
+		require.Equal(t, &OverflowError{Field: "f", Value: math.MaxInt64 + 1}, err)
+	})
+}
+
+func TestWireProtocolEncoder_Options(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 678901234, time.UTC)
+	d := 90*time.Minute + 500*time.Millisecond
+
+	tests := []struct {
+		name   string
+		opts   WireOptions
+		expect string
+	}{
+		{"default", WireOptions{}, " f=5400500000000i 1546398245678901234"},
+		{"ns", WireOptions{Precision: time.Nanosecond, DurationFormat: DurationNanoseconds}, " f=5400500000000i 1546398245678901234"},
+		{"us", WireOptions{Precision: time.Microsecond}, " f=5400500000000i 1546398245678901"},
+		{"ms", WireOptions{Precision: time.Millisecond}, " f=5400500000000i 1546398245678"},
+		{"s", WireOptions{Precision: time.Second, DurationFormat: DurationSeconds}, " f=5400i 1546398245"},
+		{"float_s", WireOptions{DurationFormat: DurationFloatSeconds}, " f=5400.5 1546398245678901234"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			enc := wireProtocolEncoder{opts: test.opts}
+			require.NoError(t, enc.Field("f", d))
+			enc.Timestamp(tm)
+			require.Equal(t, test.expect, enc.String())
+		})
+	}
+}
+
+func TestParsePrecision(t *testing.T) {
+	for s, expect := range map[string]time.Duration{
+		"":   time.Nanosecond,
+		"ns": time.Nanosecond,
+		"us": time.Microsecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+	} {
+		precision, err := ParsePrecision(s)
+		require.NoError(t, err)
+		require.Equal(t, expect, precision)
+	}
+
+	_, err := ParsePrecision("m")
+	require.EqualError(t, err, "unknown precision: m")
+}
+
+func TestParseDurationFormat(t *testing.T) {
+	format, err := ParseDurationFormat("")
+	require.NoError(t, err)
+	require.Equal(t, DurationNanoseconds, format)
+
+	format, err = ParseDurationFormat("float_s")
+	require.NoError(t, err)
+	require.Equal(t, DurationFloatSeconds, format)
+
+	_, err = ParseDurationFormat("ms")
+	require.EqualError(t, err, "unknown duration format: ms")
+}
+
+func TestEncoder(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := Datum{
+		Name:   "test",
+		Time:   tm,
+		Tags:   map[string]string{"tag2": "b", "tag1": "a"},
+		Fields: map[string]interface{}{"field2": true, "field1": 1},
+	}
+
+	tests := []struct {
+		format Format
+		expect string
+	}{
+		{
+			FormatInfluxDB,
+			"test,tag1=a,tag2=b field1=1i,field2=t 1546398245000000000\n",
+		},
+		{
+			FormatJSON,
+			`{"name":"test","time":"2019-01-02T03:04:05Z","timestamp":1546398245000000000,` +
+				`"tags":{"tag1":"a","tag2":"b"},"fields":{"field1":1,"field2":true}}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf, test.format, WireOptions{})
+
+			require.NoError(t, enc.Encode(d))
+			require.NoError(t, enc.Encode(d))
+			require.Equal(t, test.expect+test.expect, buf.String())
+
+			// a datum that cannot be encoded writes nothing
+			err := enc.Encode(Datum{Name: "test", Fields: map[string]interface{}{"f": nil}})
+			require.EqualError(t, err, "field value is nil")
+			require.Equal(t, test.expect+test.expect, buf.String())
+		})
+	}
+}
+
+func TestEncoder_Allocs(t *testing.T) {
+	d := benchmarkDatum()
+
+	for _, format := range []Format{FormatInfluxDB, FormatJSON} {
+		enc := NewEncoder(ioutil.Discard, format, WireOptions{})
+
+		allocs := testing.AllocsPerRun(100, func() {
+			_ = enc.Encode(d)
+		})
+
+		// sort.Strings may allocate, depending on the version of Go
+		require.True(t, allocs <= 2, "%s: %v allocations per datum", format, allocs)
+	}
+}
+
+func TestJSONEncoder_string(t *testing.T) {
+	for _, s := range []string{"", "test", `a "b" \c`, "<&>", "tab\t", "é☃", "\xff"} {
+		b, err := json.Marshal(s)
+		require.NoError(t, err)
+
+		var enc jsonEncoder
+		enc.string(s)
+		require.Equal(t, string(b), enc.String())
+	}
+}
+
+// benchmarkDatum returns a datum like those of the aws_ec2_instance source.
+func benchmarkDatum() Datum {
+	return Datum{
+		Name: "aws_ec2_instance",
+		Time: time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags: map[string]string{
+			"account":           "123456789012",
+			"region":            "eu-west-1",
+			"availability_zone": "eu-west-1a",
+			"instance_id":       "i-0123456789abcdef0",
+			"instance_type":     "t3.micro",
+			"state":             "running",
+			"name":              "web server, eu",
+		},
+		Fields: map[string]interface{}{
+			"age":        36 * time.Hour,
+			"launched":   time.Date(2018, 12, 31, 15, 4, 5, 0, time.UTC),
+			"cpu_count":  2,
+			"ebs":        true,
+			"price":      0.0114,
+			"image_id":   "ami-0123456789abcdef0",
+			"public_ips": uint32(1),
+		},
+	}
+}
+
+func BenchmarkEncoder_WireProtocol(b *testing.B) {
+	enc := NewEncoder(ioutil.Discard, FormatInfluxDB, WireOptions{})
+	d := benchmarkDatum()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(d); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncoder_JSON(b *testing.B) {
+	enc := NewEncoder(ioutil.Discard, FormatJSON, WireOptions{})
+	d := benchmarkDatum()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(d); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDatum_ToInfluxDBWireProtocol(b *testing.B) {
+	d := benchmarkDatum()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.ToInfluxDBWireProtocol(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
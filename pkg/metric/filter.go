@@ -0,0 +1,158 @@
+package metric
+
+import (
+	"unicode/utf8"
+)
+
+// Filter selects data by their names and tags, like the namepass, namedrop,
+// tagpass and tagdrop options of telegraf, and limits the fields and tags of
+// the data selected, like fieldpass, fielddrop, taginclude and tagexclude. All
+// patterns are globs, as matched by MatchGlob. The zero value selects every
+// datum, unchanged.
+type Filter struct {
+	// NamePass selects only the data whose names match any of the patterns.
+	NamePass []string
+
+	// NameDrop rejects the data whose names match any of the patterns.
+	NameDrop []string
+
+	// TagPass selects only the data with a tag of the given names whose value
+	// matches any of the patterns of that tag.
+	TagPass map[string][]string
+
+	// TagDrop rejects the data with a tag of the given names whose value
+	// matches any of the patterns of that tag.
+	TagDrop map[string][]string
+
+	// FieldPass keeps only the fields whose names match any of the patterns.
+	FieldPass []string
+
+	// FieldDrop removes the fields whose names match any of the patterns.
+	FieldDrop []string
+
+	// TagInclude keeps only the tags whose names match any of the patterns.
+	TagInclude []string
+
+	// TagExclude removes the tags whose names match any of the patterns.
+	TagExclude []string
+}
+
+// Match returns whether the filter selects the datum, by its name and tags.
+func (f *Filter) Match(datum Datum) bool {
+	if len(f.NamePass) > 0 && !matchAny(f.NamePass, datum.Name) {
+		return false
+	}
+
+	if matchAny(f.NameDrop, datum.Name) {
+		return false
+	}
+
+	if len(f.TagPass) > 0 && !matchTags(f.TagPass, datum.Tags) {
+		return false
+	}
+
+	if matchTags(f.TagDrop, datum.Tags) {
+		return false
+	}
+
+	return true
+}
+
+// Apply returns whether the filter selects the datum, and removes the fields
+// and tags of the datum that it excludes, in place. The tags are matched
+// before any are removed. A datum left without fields is not selected.
+func (f *Filter) Apply(datum *Datum) bool {
+	if !f.Match(*datum) {
+		return false
+	}
+
+	if len(f.FieldPass) > 0 || len(f.FieldDrop) > 0 {
+		for name := range datum.Fields {
+			if !keep(f.FieldPass, f.FieldDrop, name) {
+				delete(datum.Fields, name)
+			}
+		}
+
+		if len(datum.Fields) == 0 {
+			return false
+		}
+	}
+
+	if len(f.TagInclude) > 0 || len(f.TagExclude) > 0 {
+		for name := range datum.Tags {
+			if !keep(f.TagInclude, f.TagExclude, name) {
+				delete(datum.Tags, name)
+			}
+		}
+	}
+
+	return true
+}
+
+// keep returns whether a name is included by pass, or pass is empty, and not
+// excluded by drop.
+func keep(pass, drop []string, name string) bool {
+	return (len(pass) == 0 || matchAny(pass, name)) && !matchAny(drop, name)
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if MatchGlob(pattern, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchTags returns whether any of the tags matches the patterns given for it.
+func matchTags(patterns map[string][]string, tags map[string]string) bool {
+	for name, tagPatterns := range patterns {
+		if value, ok := tags[name]; ok && matchAny(tagPatterns, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchGlob returns whether the string matches the pattern, in which * stands
+// for any sequence of characters, and ? for any single character. Unlike
+// path.Match, * also matches slashes, such as those in IAM paths.
+func MatchGlob(pattern, s string) bool {
+	// the positions to backtrack to, after the last * seen
+	starP, starS := -1, 0
+	p, i := 0, 0
+
+	for i < len(s) {
+		c, size := utf8.DecodeRuneInString(s[i:])
+
+		if p < len(pattern) {
+			switch pc, psize := utf8.DecodeRuneInString(pattern[p:]); {
+			case pc == '*':
+				starP, starS = p, i
+				p++
+				continue
+			case pc == '?' || pc == c:
+				p += psize
+				i += size
+				continue
+			}
+		}
+
+		if starP < 0 {
+			return false
+		}
+
+		// let the last * match one more character
+		_, size = utf8.DecodeRuneInString(s[starS:])
+		starS += size
+		p, i = starP+1, starS
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
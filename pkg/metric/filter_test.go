@@ -0,0 +1,109 @@
+package metric
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		expect  bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "/division/team/", true},
+		{"aws_iam_*", "aws_iam_user", true},
+		{"aws_iam_*", "aws_ec2_instance", false},
+		{"*_instance", "aws_ec2_instance", true},
+		{"aws_*_instance*", "aws_ec2_instance", true},
+		{"/ops/*", "/ops/team/a/", true},
+		{"/ops/*/", "/ops/team/a/", true},
+		{"/ops/*/", "/ops/team/a", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a?c", "aéc", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+		{"**", "abc", true},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expect, MatchGlob(test.pattern, test.s), "%q %q", test.pattern, test.s)
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	datum := Datum{
+		Name: "aws_iam_user",
+		Tags: map[string]string{"account": "team-a-prod", "user_path": "/ops/"},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		expect bool
+	}{
+		{"empty", Filter{}, true},
+		{"namepass", Filter{NamePass: []string{"aws_ec2_*", "aws_iam_*"}}, true},
+		{"namepass mismatch", Filter{NamePass: []string{"aws_ec2_*"}}, false},
+		{"namedrop", Filter{NameDrop: []string{"aws_iam_*"}}, false},
+		{"namedrop mismatch", Filter{NameDrop: []string{"aws_ec2_*"}}, true},
+		{"tagpass", Filter{TagPass: map[string][]string{"account": {"team-b-*", "team-a-*"}}}, true},
+		{"tagpass mismatch", Filter{TagPass: map[string][]string{"account": {"team-b-*"}}}, false},
+		{"tagpass any tag", Filter{TagPass: map[string][]string{"account": {"team-b-*"}, "user_path": {"/ops/*"}}}, true},
+		{"tagpass missing tag", Filter{TagPass: map[string][]string{"region": {"*"}}}, false},
+		{"tagdrop", Filter{TagDrop: map[string][]string{"user_path": {"/ops/*"}}}, false},
+		{"tagdrop missing tag", Filter{TagDrop: map[string][]string{"region": {"*"}}}, true},
+		{"namepass and tagdrop", Filter{NamePass: []string{"aws_*"}, TagDrop: map[string][]string{"account": {"*-prod"}}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expect, test.filter.Match(datum))
+		})
+	}
+}
+
+func TestFilter_Apply(t *testing.T) {
+	datum := func() Datum {
+		return Datum{
+			Name:   "aws_ec2_instance",
+			Tags:   map[string]string{"image_name": "base", "image_id": "ami-1", "region": "eu-west-1"},
+			Fields: map[string]interface{}{"age": 1, "count": 2, "cpu_count": 3},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		filter       Filter
+		expect       bool
+		expectTags   []string
+		expectFields []string
+	}{
+		{"empty", Filter{}, true, []string{"image_id", "image_name", "region"}, []string{"age", "count", "cpu_count"}},
+		{"namedrop", Filter{NameDrop: []string{"aws_*"}}, false, nil, nil},
+		{"fieldpass", Filter{FieldPass: []string{"*count"}}, true, []string{"image_id", "image_name", "region"}, []string{"count", "cpu_count"}},
+		{"fielddrop", Filter{FieldDrop: []string{"*count"}}, true, []string{"image_id", "image_name", "region"}, []string{"age"}},
+		{"fieldpass and fielddrop", Filter{FieldPass: []string{"*count"}, FieldDrop: []string{"cpu_*"}}, true, []string{"image_id", "image_name", "region"}, []string{"count"}},
+		{"no fields left", Filter{FieldDrop: []string{"*"}}, false, nil, nil},
+		{"taginclude", Filter{TagInclude: []string{"image_*"}}, true, []string{"image_id", "image_name"}, []string{"age", "count", "cpu_count"}},
+		{"tagexclude", Filter{TagExclude: []string{"image_name"}}, true, []string{"image_id", "region"}, []string{"age", "count", "cpu_count"}},
+		{"tagpass before tagexclude", Filter{TagPass: map[string][]string{"image_name": {"base"}}, TagExclude: []string{"image_name"}}, true, []string{"image_id", "region"}, []string{"age", "count", "cpu_count"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := datum()
+			require.Equal(t, test.expect, test.filter.Apply(&d))
+			if !test.expect {
+				return
+			}
+
+			require.Equal(t, test.expectTags, (&Encoder{}).sortedTags(d.Tags))
+			require.Equal(t, test.expectFields, (&Encoder{}).sortedFields(d.Fields))
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+type jsonEncoder struct {
+	bytes.Buffer
+	count int
+
+	// num is a scratch buffer for formatting numbers and times without
+	// allocating
+	num []byte
+}
+
+func (enc *jsonEncoder) string(s string) {
+	if !jsonSafe(s) {
+		// strings always marshal successfully
+		b, _ := json.Marshal(s)
+		enc.Write(b)
+		return
+	}
+
+	enc.WriteByte('"')
+	enc.WriteString(s)
+	enc.WriteByte('"')
+}
+
+// jsonSafe returns whether the string can be written as is, i.e. that it
+// contains only printable ASCII characters that json.Marshal does not escape.
+func jsonSafe(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c < 0x20 || c >= 0x80:
+			return false
+		case c == '"' || c == '\\' || c == '<' || c == '>' || c == '&':
+			return false
+		}
+	}
+
+	return true
+}
+
+// key writes the key of the next member of an object, preceded by a comma if
+// it is not the first.
+func (enc *jsonEncoder) key(name string) {
+	if enc.count > 0 {
+		enc.WriteByte(',')
+	}
+
+	enc.count++
+	enc.string(name)
+	enc.WriteByte(':')
+}
+
+func (enc *jsonEncoder) Begin() {
+	enc.WriteByte('{')
+	enc.count = 0
+}
+
+func (enc *jsonEncoder) End() {
+	enc.WriteByte('}')
+	enc.count = 1
+}
+
+func (enc *jsonEncoder) Name(name string) {
+	enc.key("name")
+	enc.string(name)
+}
+
+// Timestamp writes the time both as an RFC 3339 string, and as nanoseconds
+// since the epoch.
+func (enc *jsonEncoder) Timestamp(t time.Time) {
+	enc.key("time")
+	enc.time(t)
+	enc.key("timestamp")
+	enc.writeInt(t.UnixNano())
+}
+
+func (enc *jsonEncoder) Tag(name, value string) {
+	enc.key(name)
+	enc.string(value)
+}
+
+// Field writes the value as its closest JSON type. Integers are written in
+// full, even where they exceed the precision of a float64. Durations are
+// written as nanoseconds, and times as RFC 3339 strings.
+func (enc *jsonEncoder) Field(name string, value interface{}) error {
+	enc.key(name)
+
+	switch v := value.(type) {
+	case int:
+		enc.writeInt(int64(v))
+	case int8:
+		enc.writeInt(int64(v))
+	case int16:
+		enc.writeInt(int64(v))
+	case int32:
+		enc.writeInt(int64(v))
+	case int64:
+		enc.writeInt(v)
+	case uint:
+		enc.writeUint(uint64(v))
+	case uint8:
+		enc.writeUint(uint64(v))
+	case uint16:
+		enc.writeUint(uint64(v))
+	case uint32:
+		enc.writeUint(uint64(v))
+	case uint64:
+		enc.writeUint(v)
+	case string:
+		enc.string(v)
+	case time.Time:
+		enc.time(v)
+	case time.Duration:
+		enc.writeInt(v.Nanoseconds())
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return errors.Errorf("field value is not a finite number: %v", v)
+		}
+
+		enc.writeFloat(float64(v), 32)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.Errorf("field value is not a finite number: %v", v)
+		}
+
+		enc.writeFloat(v, 64)
+	case bool:
+		enc.WriteString(strconv.FormatBool(v))
+	case fmt.Stringer:
+		// Stringer should come as late as possible, as types like time.Duration
+		// require special handling.
+		enc.string(v.String())
+	case nil:
+		return errors.New("field value is nil")
+	default:
+		name := "(unknown)"
+		if t := reflect.TypeOf(value); t != nil {
+			name = t.String()
+		}
+
+		return errors.Errorf("unknown field type: %s", name)
+	}
+
+	return nil
+}
+
+func (enc *jsonEncoder) Reset() {
+	enc.Buffer.Reset()
+	enc.count = 0
+}
+
+func (enc *jsonEncoder) time(t time.Time) {
+	enc.num = t.UTC().AppendFormat(append(enc.num[:0], '"'), time.RFC3339Nano)
+	enc.num = append(enc.num, '"')
+	_, _ = enc.Write(enc.num)
+}
+
+func (enc *jsonEncoder) writeInt(v int64) {
+	enc.num = strconv.AppendInt(enc.num[:0], v, 10)
+	_, _ = enc.Write(enc.num)
+}
+
+func (enc *jsonEncoder) writeUint(v uint64) {
+	enc.num = strconv.AppendUint(enc.num[:0], v, 10)
+	_, _ = enc.Write(enc.num)
+}
+
+func (enc *jsonEncoder) writeFloat(v float64, bitSize int) {
+	enc.num = strconv.AppendFloat(enc.num[:0], v, 'g', -1, bitSize)
+	_, _ = enc.Write(enc.num)
+}
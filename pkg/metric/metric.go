@@ -1,8 +1,9 @@
 package metric
 
 import (
-	"github.com/tetratom/cloudsurvey/internal/util"
-	"sort"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
 	"sync"
 	"time"
 )
@@ -16,51 +17,135 @@ type Datum struct {
 	Fields map[string]interface{}
 }
 
+// Format is an encoding of individual data, one per line.
+type Format string
+
+const (
+	FormatInfluxDB Format = "influx"
+	FormatJSON     Format = "json"
+)
+
+// ParseFormat returns the format of the given name. The empty string stands
+// for FormatInfluxDB.
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(s); format {
+	case "":
+		return FormatInfluxDB, nil
+	case FormatInfluxDB, FormatJSON:
+		return format, nil
+	default:
+		return "", errors.Errorf("unknown format: %s", s)
+	}
+}
+
 var (
 	encoderPool = sync.Pool{
 		New: func() interface{} {
-			return &wireProtocolEncoder{}
+			return &Encoder{}
 		},
 	}
 )
 
 func (m Datum) ToInfluxDBWireProtocol() (string, error) {
-	// keys is a slice used for sorting tags and fields
-	keys := make([]string, 0, util.MaxInt(len(m.Tags), len(m.Fields)))
+	return m.WireProtocol(WireOptions{})
+}
+
+// WireProtocol encodes the datum in the InfluxDB wire protocol, with the given
+// options.
+func (m Datum) WireProtocol(opts WireOptions) (string, error) {
+	return m.Encode(FormatInfluxDB, opts)
+}
 
-	enc := encoderPool.Get().(*wireProtocolEncoder)
+// ToJSON encodes the datum as a JSON object, on a single line, of the form:
+//
+//	{"name":"...","time":"...","timestamp":...,"tags":{...},"fields":{...}}
+//
+// The time is given both in RFC 3339 format, and as the timestamp in
+// nanoseconds since the epoch. Fields keep their types, with durations given
+// in nanoseconds, and times in RFC 3339 format.
+func (m Datum) ToJSON() (string, error) {
+	return m.Encode(FormatJSON, WireOptions{})
+}
 
-	enc.Measurement(m.Name)
+// Encode encodes the datum in the given format. The options apply to the
+// InfluxDB wire protocol only. To encode many data, an Encoder avoids
+// allocating a string for each.
+func (m Datum) Encode(format Format, opts WireOptions) (string, error) {
+	enc := encoderPool.Get().(*Encoder)
+	defer encoderPool.Put(enc)
 
-	// ensure tags are ordered lexically
-	keys = keys[:0]
-	for k := range m.Tags {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
+	enc.format = format
+	enc.wire.opts = opts
 
-	for _, k := range keys {
-		enc.Tag(k, m.Tags[k])
+	buf, err := enc.encode(m)
+	if err != nil {
+		return "", err
 	}
 
-	// ensure fields are ordered lexically
-	keys = keys[:0]
-	for k := range m.Fields {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
+	return buf.String(), nil
+}
+
+// ToPrometheusTextFormat encodes the data in the Prometheus text exposition
+// format. Every numeric field becomes a gauge named after the datum and the
+// field, e.g. aws_iam_user_age, with the tags as its labels. Timestamps are
+// omitted, such that the samples take the time of the scrape.
+func ToPrometheusTextFormat(data []Datum) (string, error) {
+	var enc prometheusEncoder
 
-	for _, k := range keys {
-		if err := enc.Field(k, m.Fields[k]); err != nil {
+	for _, datum := range data {
+		if err := enc.Datum(datum); err != nil {
 			return "", err
 		}
 	}
 
-	enc.Timestamp(m.Time)
-
-	s := enc.String()
-	enc.Reset()
-	encoderPool.Put(enc)
+	enc.Flush()
+	return enc.String(), nil
+}
 
-	return s, nil
+// FloatValue converts a field value to a float, for outputs that only have
+// numeric values. Durations are given in seconds, times as seconds since the
+// epoch, and bools as 0 or 1. Returns false for values that have no numeric
+// representation, such as strings.
+func FloatValue(value interface{}) (float64, bool, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true, nil
+	case int8:
+		return float64(v), true, nil
+	case int16:
+		return float64(v), true, nil
+	case int32:
+		return float64(v), true, nil
+	case int64:
+		return float64(v), true, nil
+	case uint:
+		return float64(v), true, nil
+	case uint8:
+		return float64(v), true, nil
+	case uint16:
+		return float64(v), true, nil
+	case uint32:
+		return float64(v), true, nil
+	case uint64:
+		return float64(v), true, nil
+	case float32:
+		return float64(v), true, nil
+	case float64:
+		return v, true, nil
+	case bool:
+		if v {
+			return 1, true, nil
+		}
+		return 0, true, nil
+	case time.Duration:
+		return v.Seconds(), true, nil
+	case time.Time:
+		return float64(v.UnixNano()) / 1e9, true, nil
+	case string, fmt.Stringer:
+		return 0, false, nil
+	case nil:
+		return 0, false, errors.New("field value is nil")
+	default:
+		return 0, false, errors.Errorf("unknown field type: %s", reflect.TypeOf(value))
+	}
 }
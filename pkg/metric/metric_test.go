@@ -1,7 +1,9 @@
 package metric
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/require"
+	"math"
 	"testing"
 	"time"
 )
@@ -32,3 +34,89 @@ func TestDatum_ToInfluxDBWireProtocol(t *testing.T) {
 		})
 	}
 }
+
+func TestDatum_ToJSON(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	tests := []struct {
+		s string
+		d Datum
+	}{
+		{
+			`{"name":"test","time":"2019-01-02T03:04:05.000000006Z","timestamp":1546398245000000006,"tags":{"tag1":"a","tag2":"\"b\""},"fields":{"field1":1,"field2":true,"field3":18446744073709551615,"field4":90000000000,"field5":"2019-01-02T03:04:05.000000006Z","field6":1.5,"field7":"x"}}`,
+			Datum{
+				Name: "test",
+				Time: tm,
+				Tags: map[string]string{"tag1": "a", "tag2": `"b"`},
+				Fields: map[string]interface{}{
+					"field1": 1,
+					"field2": true,
+					"field3": uint64(math.MaxUint64),
+					"field4": 90 * time.Second,
+					"field5": tm,
+					"field6": 1.5,
+					"field7": "x",
+				},
+			},
+		},
+		{
+			`{"name":"test","time":"2019-01-02T03:04:05.000000006Z","timestamp":1546398245000000006,"tags":{},"fields":{}}`,
+			Datum{Name: "test", Time: tm},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			s, err := test.d.ToJSON()
+			require.NoError(t, err)
+			require.Equal(t, test.s, s)
+			require.True(t, json.Valid([]byte(s)))
+		})
+	}
+
+	t.Run("invalid field", func(t *testing.T) {
+		_, err := Datum{Fields: map[string]interface{}{"f": math.NaN()}}.ToJSON()
+		require.EqualError(t, err, "field value is not a finite number: NaN")
+	})
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("")
+	require.NoError(t, err)
+	require.Equal(t, FormatInfluxDB, format)
+
+	format, err = ParseFormat("json")
+	require.NoError(t, err)
+	require.Equal(t, FormatJSON, format)
+
+	_, err = ParseFormat("xml")
+	require.EqualError(t, err, "unknown format: xml")
+}
+
+func TestFloatValue(t *testing.T) {
+	tests := []struct {
+		input  interface{}
+		expect float64
+		ok     bool
+	}{
+		{1, 1, true},
+		{int64(-2), -2, true},
+		{uint64(3), 3, true},
+		{1.5, 1.5, true},
+		{true, 1, true},
+		{false, 0, true},
+		{1500 * time.Millisecond, 1.5, true},
+		{time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC), 1546398245, true},
+		{"test", 0, false},
+	}
+
+	for _, test := range tests {
+		v, ok, err := FloatValue(test.input)
+		require.NoError(t, err)
+		require.Equal(t, test.ok, ok)
+		require.Equal(t, test.expect, v)
+	}
+
+	_, _, err := FloatValue(nil)
+	require.EqualError(t, err, "field value is nil")
+}
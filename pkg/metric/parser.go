@@ -0,0 +1,226 @@
+package metric
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxLineSize is the longest line read by ReadInfluxDBWireProtocol.
+const MaxLineSize = 1024 * 1024
+
+// ParseInfluxDBWireProtocol parses a single line of the InfluxDB wire
+// protocol, as written by ToInfluxDBWireProtocol, with a timestamp in
+// nanoseconds. Integers are parsed as int64, unsigned integers as uint64, and
+// other numbers as float64. A line without a timestamp has the zero time.
+//
+// Escaping follows the encoder: a backslash escapes a comma or space in the
+// measurement, and a comma, space or equals sign in keys and tag values, but
+// is otherwise taken literally. Keys and tag values ending in a backslash
+// cannot be represented.
+func ParseInfluxDBWireProtocol(line string) (Datum, error) {
+	p := wireProtocolParser{s: line}
+	return p.parse()
+}
+
+// ReadInfluxDBWireProtocol parses every line read from r. Empty lines, and
+// comments starting with #, are skipped.
+func ReadInfluxDBWireProtocol(r io.Reader) ([]Datum, error) {
+	var data []Datum
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, MaxLineSize)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		datum, err := ParseInfluxDBWireProtocol(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+
+		data = append(data, datum)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+type wireProtocolParser struct {
+	s string
+	i int
+}
+
+func (p *wireProtocolParser) parse() (Datum, error) {
+	var datum Datum
+
+	datum.Name = p.token(", ", ", ")
+	if datum.Name == "" {
+		return datum, errors.New("missing measurement")
+	}
+
+	for p.peek() == ',' {
+		p.i++
+
+		key := p.token(",= ", ",= ")
+		if err := p.expect('='); err != nil {
+			return datum, err
+		}
+
+		if datum.Tags == nil {
+			datum.Tags = make(map[string]string)
+		}
+
+		datum.Tags[key] = p.token(", ", ",= ")
+	}
+
+	if err := p.expect(' '); err != nil {
+		return datum, err
+	}
+
+	datum.Fields = make(map[string]interface{})
+
+	for {
+		key := p.token(",= ", ",= ")
+		if err := p.expect('='); err != nil {
+			return datum, err
+		}
+
+		value, err := p.fieldValue()
+		if err != nil {
+			return datum, errors.Wrapf(err, "field %s", key)
+		}
+
+		datum.Fields[key] = value
+
+		if p.peek() != ',' {
+			break
+		}
+
+		p.i++
+	}
+
+	if p.i == len(p.s) {
+		return datum, nil
+	}
+
+	if err := p.expect(' '); err != nil {
+		return datum, err
+	}
+
+	ts, err := strconv.ParseInt(strings.TrimSpace(p.s[p.i:]), 10, 64)
+	if err != nil {
+		return datum, errors.Wrap(err, "timestamp")
+	}
+
+	datum.Time = time.Unix(0, ts).UTC()
+	return datum, nil
+}
+
+func (p *wireProtocolParser) peek() byte {
+	if p.i < len(p.s) {
+		return p.s[p.i]
+	}
+
+	return 0
+}
+
+func (p *wireProtocolParser) expect(c byte) error {
+	if p.peek() != c {
+		if p.i == len(p.s) {
+			return errors.Errorf("column %d: expected %q, found end of line", p.i+1, c)
+		}
+
+		return errors.Errorf("column %d: expected %q, found %q", p.i+1, c, p.s[p.i])
+	}
+
+	p.i++
+	return nil
+}
+
+// token reads up to the next unescaped delimiter, or the end of the line. A
+// backslash followed by one of the escapable characters stands for that
+// character.
+func (p *wireProtocolParser) token(delimiters, escapable string) string {
+	var sb strings.Builder
+
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+
+		if c == '\\' && p.i+1 < len(p.s) && strings.IndexByte(escapable, p.s[p.i+1]) >= 0 {
+			sb.WriteByte(p.s[p.i+1])
+			p.i += 2
+			continue
+		}
+
+		if strings.IndexByte(delimiters, c) >= 0 {
+			break
+		}
+
+		sb.WriteByte(c)
+		p.i++
+	}
+
+	return sb.String()
+}
+
+func (p *wireProtocolParser) fieldValue() (interface{}, error) {
+	if p.peek() == '"' {
+		return p.quoted()
+	}
+
+	s := p.token(", ", "")
+	if s == "" {
+		return nil, errors.New("missing value")
+	}
+
+	switch s {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+
+	switch s[len(s)-1] {
+	case 'i':
+		return strconv.ParseInt(s[:len(s)-1], 10, 64)
+	case 'u':
+		return strconv.ParseUint(s[:len(s)-1], 10, 64)
+	default:
+		return strconv.ParseFloat(s, 64)
+	}
+}
+
+// quoted reads a string field value, in which a backslash escapes a double
+// quote or another backslash.
+func (p *wireProtocolParser) quoted() (string, error) {
+	var sb strings.Builder
+	p.i++
+
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+
+		switch {
+		case c == '\\' && p.i+1 < len(p.s) && (p.s[p.i+1] == '"' || p.s[p.i+1] == '\\'):
+			sb.WriteByte(p.s[p.i+1])
+			p.i += 2
+		case c == '"':
+			p.i++
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+			p.i++
+		}
+	}
+
+	return "", errors.New("unterminated string")
+}
@@ -0,0 +1,201 @@
+package metric
+
+import (
+	"flag"
+	"github.com/stretchr/testify/require"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInfluxDBWireProtocol(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		s string
+		d Datum
+	}{
+		{
+			"test,tag1=a,tag2=b field1=1i,field2=t 1546398245000000000",
+			Datum{
+				Name:   "test",
+				Time:   tm,
+				Tags:   map[string]string{"tag1": "a", "tag2": "b"},
+				Fields: map[string]interface{}{"field1": int64(1), "field2": true},
+			},
+		},
+		{
+			`te\ s\,t,t\ a\,g\==v\ a\,l\=ue f\ i\,e\=ld="q\"uo\\te" 1546398245000000000`,
+			Datum{
+				Name:   "te s,t",
+				Time:   tm,
+				Tags:   map[string]string{"t a,g=": "v a,l=ue"},
+				Fields: map[string]interface{}{"f i,e=ld": `q"uo\te`},
+			},
+		},
+		{
+			`a\b,t=c\d f="e\f"`,
+			Datum{
+				Name:   `a\b`,
+				Tags:   map[string]string{"t": `c\d`},
+				Fields: map[string]interface{}{"f": `e\f`},
+			},
+		},
+		{
+			"test i=-1i,u=18446744073709551615u,f=1.5,e=1e3,b1=true,b2=FALSE,b3=F,s=\"a b,c=d\" -1",
+			Datum{
+				Name: "test",
+				Time: time.Unix(0, -1).UTC(),
+				Fields: map[string]interface{}{
+					"i":  int64(-1),
+					"u":  uint64(math.MaxUint64),
+					"f":  1.5,
+					"e":  1000.0,
+					"b1": true,
+					"b2": false,
+					"b3": false,
+					"s":  "a b,c=d",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			d, err := ParseInfluxDBWireProtocol(test.s)
+			require.NoError(t, err)
+			require.Equal(t, test.d, d)
+		})
+	}
+}
+
+func TestParseInfluxDBWireProtocol_Error(t *testing.T) {
+	tests := []struct {
+		s   string
+		err string
+	}{
+		{"", "missing measurement"},
+		{" f=1", "missing measurement"},
+		{"test", `column 5: expected ' ', found end of line`},
+		{"test,t f=1", `column 7: expected '=', found ' '`},
+		{"test f", `column 7: expected '=', found end of line`},
+		{"test f=", "field f: missing value"},
+		{"test f=x", `field f: strconv.ParseFloat: parsing "x": invalid syntax`},
+		{"test f=1.5i", `field f: strconv.ParseInt: parsing "1.5": invalid syntax`},
+		{"test f=-1u", `field f: strconv.ParseUint: parsing "-1": invalid syntax`},
+		{`test f="x`, "field f: unterminated string"},
+		{`test f="x"y`, `column 11: expected ' ', found 'y'`},
+		{"test f=1 x", `timestamp: strconv.ParseInt: parsing "x": invalid syntax`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			_, err := ParseInfluxDBWireProtocol(test.s)
+			require.EqualError(t, err, test.err)
+		})
+	}
+}
+
+func TestReadInfluxDBWireProtocol(t *testing.T) {
+	s := "# comment\na f=1i 1\n\n  b f=2i 2  \n"
+
+	data, err := ReadInfluxDBWireProtocol(strings.NewReader(s))
+	require.NoError(t, err)
+	require.Equal(t, []Datum{
+		{Name: "a", Time: time.Unix(0, 1).UTC(), Fields: map[string]interface{}{"f": int64(1)}},
+		{Name: "b", Time: time.Unix(0, 2).UTC(), Fields: map[string]interface{}{"f": int64(2)}},
+	}, data)
+
+	_, err = ReadInfluxDBWireProtocol(strings.NewReader("a f=1i\nb\n"))
+	require.EqualError(t, err, `line 2: column 2: expected ' ', found end of line`)
+}
+
+// roundTripSeed seeds the random data of TestWireProtocol_RoundTrip, such that
+// CI is deterministic, while other data can be tried with -roundtrip.seed.
+var roundTripSeed = flag.Int64("roundtrip.seed", 1, "seed of the random data of TestWireProtocol_RoundTrip")
+
+// TestWireProtocol_RoundTrip encodes random data, with names, tags and
+// strings full of characters that need escaping, and checks that parsing them
+// gives back the same data.
+func TestWireProtocol_RoundTrip(t *testing.T) {
+	seed := *roundTripSeed
+	r := rand.New(rand.NewSource(seed))
+	opts := WireOptions{Unsigned: true}
+
+	for i := 0; i < 10000; i++ {
+		datum := randomDatum(r)
+
+		line, err := datum.WireProtocol(opts)
+		require.NoError(t, err)
+
+		parsed, err := ParseInfluxDBWireProtocol(line)
+		require.NoError(t, err, "seed %d: %s", seed, line)
+		require.Equal(t, datum, parsed, "seed %d: %s", seed, line)
+
+		again, err := parsed.WireProtocol(opts)
+		require.NoError(t, err)
+		require.Equal(t, line, again, "seed %d", seed)
+	}
+}
+
+// randomDatum returns a datum with the types produced by the parser. Names,
+// keys and tag values do not end in a backslash, which would escape the
+// following delimiter.
+func randomDatum(r *rand.Rand) Datum {
+	datum := Datum{
+		Name:   randomString(r, 1, false),
+		Time:   time.Unix(0, r.Int63()-r.Int63()).UTC(),
+		Fields: make(map[string]interface{}),
+	}
+
+	if n := r.Intn(4); n > 0 {
+		datum.Tags = make(map[string]string)
+		for i := 0; i < n; i++ {
+			datum.Tags[randomString(r, 1, false)] = randomString(r, 0, false)
+		}
+	}
+
+	for i := r.Intn(5); i >= 0; i-- {
+		var value interface{}
+
+		switch r.Intn(5) {
+		case 0:
+			value = r.Int63() - r.Int63()
+		case 1:
+			value = r.Uint64()
+		case 2:
+			value = math.Float64frombits(r.Uint64())
+			if math.IsNaN(value.(float64)) || math.IsInf(value.(float64), 0) {
+				value = r.NormFloat64()
+			}
+		case 3:
+			value = r.Intn(2) == 0
+		case 4:
+			value = randomString(r, 0, true)
+		}
+
+		datum.Fields[randomString(r, 1, false)] = value
+	}
+
+	return datum
+}
+
+const randomAlphabet = `abcXYZ019_-., =\"'#é☃`
+
+func randomString(r *rand.Rand, min int, trailingBackslash bool) string {
+	alphabet := []rune(randomAlphabet)
+	runes := make([]rune, min+r.Intn(8))
+
+	for i := range runes {
+		runes[i] = alphabet[r.Intn(len(alphabet))]
+	}
+
+	s := string(runes)
+	if !trailingBackslash && strings.HasSuffix(s, `\`) {
+		s = strings.TrimRight(s, `\`) + "x"
+	}
+
+	return s
+}
@@ -0,0 +1,185 @@
+package metric
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	helpReplacer       = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+	labelValueReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+)
+
+// prometheusFamily is the samples of a single metric, keyed by their encoded
+// labels, such that a series appears only once.
+type prometheusFamily struct {
+	help    string
+	samples map[string]float64
+}
+
+type prometheusEncoder struct {
+	bytes.Buffer
+	families map[string]*prometheusFamily
+}
+
+// Datum adds a sample for every numeric field of the datum, to the family
+// named after the datum and the field. Fields that are strings, or otherwise
+// not numeric, are skipped, and fields that are nil or of an unknown type are
+// logged and skipped. A sample replaces any previous sample with the same
+// labels.
+func (enc *prometheusEncoder) Datum(datum Datum) error {
+	if enc.families == nil {
+		enc.families = make(map[string]*prometheusFamily)
+	}
+
+	labels := enc.labels(datum.Tags)
+
+	for field, value := range datum.Fields {
+		v, ok, err := FloatValue(value)
+		if err != nil {
+			log.Printf("error: prometheus: %s: %s: %+v", datum.Name, field, err)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		name := sanitizePrometheusName(datum.Name+"_"+field, true)
+		family, ok := enc.families[name]
+		if !ok {
+			family = &prometheusFamily{
+				help:    fmt.Sprintf("field %s of %s", field, datum.Name),
+				samples: make(map[string]float64),
+			}
+			enc.families[name] = family
+		}
+
+		family.samples[labels] = v
+	}
+
+	return nil
+}
+
+// labels encodes the tags as a set of labels, e.g. {a="b",c="d"}, ordered by
+// their sanitised names.
+func (enc *prometheusEncoder) labels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	sanitised := make(map[string]string, len(tags))
+	names := make([]string, 0, len(tags))
+	for k, v := range tags {
+		name := sanitizePrometheusName(k, false)
+		if _, ok := sanitised[name]; !ok {
+			names = append(names, name)
+		}
+		sanitised[name] = v
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		_, _ = labelValueReplacer.WriteString(&sb, sanitised[name])
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+// Flush writes all families in lexical order, each preceded by its HELP and
+// TYPE lines, and forgets them.
+func (enc *prometheusEncoder) Flush() {
+	names := make([]string, 0, len(enc.families))
+	for name := range enc.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := enc.families[name]
+
+		enc.WriteString("# HELP ")
+		enc.WriteString(name)
+		enc.WriteByte(' ')
+		_, _ = helpReplacer.WriteString(enc, family.help)
+		enc.WriteString("\n# TYPE ")
+		enc.WriteString(name)
+		enc.WriteString(" gauge\n")
+
+		labels := make([]string, 0, len(family.samples))
+		for l := range family.samples {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+
+		for _, l := range labels {
+			enc.WriteString(name)
+			enc.WriteString(l)
+			enc.WriteByte(' ')
+			enc.WriteString(formatPrometheusFloat(family.samples[l]))
+			enc.WriteByte('\n')
+		}
+	}
+
+	enc.families = nil
+}
+
+func (enc *prometheusEncoder) Reset() {
+	enc.Buffer.Reset()
+	enc.families = nil
+}
+
+func formatPrometheusFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// sanitizePrometheusName replaces every character that is not allowed in the
+// name of a metric (if metric is true) or label with an underscore, and
+// prefixes names that would start with a digit.
+func sanitizePrometheusName(name string, metric bool) string {
+	var sb strings.Builder
+
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				sb.WriteByte('_')
+			}
+		case c == ':' && metric:
+		default:
+			c = '_'
+		}
+
+		sb.WriteRune(c)
+	}
+
+	if sb.Len() == 0 {
+		return "_"
+	}
+
+	return sb.String()
+}
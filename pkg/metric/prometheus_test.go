@@ -0,0 +1,102 @@
+package metric
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSanitizePrometheusName(t *testing.T) {
+	tests := []struct {
+		input  string
+		metric bool
+		expect string
+	}{
+		{"aws_iam_user", true, "aws_iam_user"},
+		{"a:b", true, "a:b"},
+		{"a:b", false, "a_b"},
+		{"tag_aws:cloudformation:stack-name", false, "tag_aws_cloudformation_stack_name"},
+		{"tag_Name", false, "tag_Name"},
+		{"1a", false, "_1a"},
+		{"tag_ä", false, "tag__"},
+		{"", false, "_"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			require.Equal(t, test.expect, sanitizePrometheusName(test.input, test.metric))
+		})
+	}
+}
+
+func TestToPrometheusTextFormat(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	data := []Datum{
+		{
+			Name: "aws_iam_user",
+			Time: tm,
+			Tags: map[string]string{"user_name": "b", "tag_team:name": `"x"`},
+			Fields: map[string]interface{}{
+				"age":              90 * time.Second,
+				"active_key_count": 1,
+				"user_arn":         "arn:aws:iam::0:user/b",
+			},
+		},
+		{
+			Name: "aws_iam_user",
+			Time: tm,
+			Tags: map[string]string{"user_name": "a"},
+			Fields: map[string]interface{}{
+				"age":              time.Hour,
+				"active_key_count": 0,
+			},
+		},
+		{
+			Name:   "cloudsurvey_run",
+			Time:   tm,
+			Fields: map[string]interface{}{"errors": 0, "ok": true},
+		},
+	}
+
+	expect := `# HELP aws_iam_user_active_key_count field active_key_count of aws_iam_user
+# TYPE aws_iam_user_active_key_count gauge
+aws_iam_user_active_key_count{tag_team_name="\"x\"",user_name="b"} 1
+aws_iam_user_active_key_count{user_name="a"} 0
+# HELP aws_iam_user_age field age of aws_iam_user
+# TYPE aws_iam_user_age gauge
+aws_iam_user_age{tag_team_name="\"x\"",user_name="b"} 90
+aws_iam_user_age{user_name="a"} 3600
+# HELP cloudsurvey_run_errors field errors of cloudsurvey_run
+# TYPE cloudsurvey_run_errors gauge
+cloudsurvey_run_errors 0
+# HELP cloudsurvey_run_ok field ok of cloudsurvey_run
+# TYPE cloudsurvey_run_ok gauge
+cloudsurvey_run_ok 1
+`
+
+	s, err := ToPrometheusTextFormat(data)
+	require.NoError(t, err)
+	require.Equal(t, expect, s)
+
+	t.Run("duplicate series", func(t *testing.T) {
+		s, err := ToPrometheusTextFormat([]Datum{
+			{Name: "a", Fields: map[string]interface{}{"b": 1}},
+			{Name: "a", Fields: map[string]interface{}{"b": 2}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "# HELP a_b field b of a\n# TYPE a_b gauge\na_b 2\n", s)
+	})
+
+	t.Run("invalid fields", func(t *testing.T) {
+		s, err := ToPrometheusTextFormat([]Datum{
+			{Name: "a", Fields: map[string]interface{}{
+				"b": 1,
+				"c": nil,
+				"d": struct{}{},
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "# HELP a_b field b of a\n# TYPE a_b gauge\na_b 1\n", s)
+	})
+}
@@ -39,3 +39,33 @@ type Credentials interface {
 	Plugin
 	Credentials(c context.Context) (Session, error)
 }
+
+type InitOutput func() Output
+
+// Output is something that delivers metrics to their destination. It should
+// consume the channel provided until it is closed, and return once all of the
+// metrics have been delivered. The data received may be shared with other
+// outputs, and must not be modified.
+type Output interface {
+	Plugin
+	Output(c context.Context, ch <-chan metric.Datum) error
+}
+
+// ResourceOutput, when implemented by an output plugin, is given the names of
+// the tags that identify the resource that data was collected from, namely
+// the metric_tags of the credentials. It is invoked before Init.
+type ResourceOutput interface {
+	SetResourceTags(names []string)
+}
+
+type InitProcessor func() Processor
+
+// Processor is something that transforms metrics between the sources and the
+// outputs. It should pass each datum, modified or not, on to the collector
+// provided, or not at all to drop it. The maps of the datum are not yet shared
+// and may be modified in place. Processors are invoked by sources running
+// concurrently, and must be safe for concurrent use.
+type Processor interface {
+	Plugin
+	Process(datum metric.Datum, collector metric.Collector)
+}
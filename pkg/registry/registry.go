@@ -2,11 +2,14 @@ package registry
 
 import (
 	"github.com/pkg/errors"
+	"sort"
 )
 
 var (
 	credentials = make(map[string]InitCredentials)
 	sources     = make(map[string]InitSource)
+	outputs     = make(map[string]InitOutput)
+	processors  = make(map[string]InitProcessor)
 )
 
 func AddSource(name string, f InitSource) {
@@ -23,6 +26,17 @@ func GetSource(name string) (InitSource, error) {
 	return source, nil
 }
 
+// ListSources returns the names of all source plugins in lexical order.
+func ListSources() []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
 func AddCredentials(name string, f InitCredentials) {
 	credentials[name] = f
 }
@@ -36,3 +50,64 @@ func GetCredentials(name string) (InitCredentials, error) {
 
 	return cred, nil
 }
+
+// ListCredentials returns the names of all credential plugins in lexical order.
+func ListCredentials() []string {
+	names := make([]string, 0, len(credentials))
+	for name := range credentials {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func AddOutput(name string, f InitOutput) {
+	outputs[name] = f
+}
+
+func GetOutput(name string) (InitOutput, error) {
+	output, ok := outputs[name]
+
+	if !ok {
+		return nil, errors.Errorf("output plugin not found: %s", name)
+	}
+
+	return output, nil
+}
+
+// ListOutputs returns the names of all output plugins in lexical order.
+func ListOutputs() []string {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func AddProcessor(name string, f InitProcessor) {
+	processors[name] = f
+}
+
+func GetProcessor(name string) (InitProcessor, error) {
+	processor, ok := processors[name]
+
+	if !ok {
+		return nil, errors.Errorf("processor plugin not found: %s", name)
+	}
+
+	return processor, nil
+}
+
+// ListProcessors returns the names of all processor plugins in lexical order.
+func ListProcessors() []string {
+	names := make([]string, 0, len(processors))
+	for name := range processors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,297 @@
+// Package spool keeps data that could not be delivered on disk, to be
+// replayed once the destination has recovered.
+package spool
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SegmentExt is the extension of segment files.
+const SegmentExt = ".lp"
+
+// typesPrefix starts the comment that follows a datum with duration or time
+// fields. The spool writes no other comments, so that names starting with #
+// are read as data. As spaces in field names are escaped, a datum named #
+// with a field named types is encoded as "# types=...", and not mistaken for
+// the comment.
+const typesPrefix = "# types "
+
+// Spool is a directory of segment files, each holding a batch of data in the
+// InfluxDB wire protocol. Segments are named after the time they were written,
+// so that they are replayed in order. A Spool is not safe for concurrent use,
+// and every directory must be used by a single Spool only.
+//
+// Data are encoded with unsigned integers, such that integers and floats are
+// replayed with the same values. Durations and times are encoded as integer
+// nanoseconds, and the datum is followed by a comment naming their types,
+// such that they are replayed as they were collected:
+//
+//	aws_iam_user,user_name=bob age=5400000000000i 1546398245000000000
+//	# types age="duration" 1546398245000000000
+type Spool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	seq     int
+
+	now func() time.Time
+}
+
+type segment struct {
+	name string
+	time time.Time
+	size int64
+}
+
+// Open returns the spool of the directory, which is created if need be. Once
+// the segments exceed maxSize bytes in total, or are older than maxAge, the
+// oldest segments are evicted. Zero stands for no limit.
+func Open(dir string, maxSize int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Spool{dir: dir, maxSize: maxSize, maxAge: maxAge, now: time.Now}, nil
+}
+
+// Append writes the data to a new segment. Data that cannot be encoded are
+// skipped.
+func (s *Spool) Append(data []metric.Datum) error {
+	now := s.now()
+	s.seq++
+
+	name := fmt.Sprintf("%020d-%06d%s", now.UnixNano(), s.seq%1000000, SegmentExt)
+	path := filepath.Join(s.dir, name)
+
+	// write to a temporary file first, such that a segment is never replayed
+	// before it is complete
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := metric.NewEncoder(w, metric.FormatInfluxDB, metric.WireOptions{Unsigned: true})
+
+	for _, datum := range data {
+		if err := enc.Encode(datum); err != nil {
+			log.Printf("error: spool %s: %s: %+v", s.dir, datum.Name, err)
+			continue
+		}
+
+		if types, ok := fieldTypes(datum); ok {
+			_, _ = w.WriteString("# ")
+			_ = enc.Encode(types)
+		}
+	}
+
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+
+	if err != nil {
+		_ = os.Remove(path + ".tmp")
+		return err
+	}
+
+	return s.evict()
+}
+
+// Replay passes the data of every segment to f, oldest first, and removes the
+// segment once f succeeds. Replay stops at the first error of f, which is
+// returned. Segments that cannot be read are logged and removed.
+func (s *Spool) Replay(f func([]metric.Datum) error) error {
+	if err := s.evict(); err != nil {
+		return err
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range segments {
+		path := filepath.Join(s.dir, seg.name)
+
+		data, err := readSegment(path)
+		if err != nil {
+			log.Printf("error: spool %s: removing unreadable segment %s: %+v", s.dir, seg.name, err)
+		} else if len(data) > 0 {
+			if err := f(data); err != nil {
+				return err
+			}
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of segments.
+func (s *Spool) Len() (int, error) {
+	segments, err := s.segments()
+	return len(segments), err
+}
+
+// evict removes the segments that are too old, and then the oldest segments
+// until the size of the rest is within the limit.
+func (s *Spool) evict() error {
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, seg := range segments {
+		size += seg.size
+	}
+
+	now := s.now()
+	for _, seg := range segments {
+		tooOld := s.maxAge > 0 && now.Sub(seg.time) > s.maxAge
+		tooLarge := s.maxSize > 0 && size > s.maxSize
+
+		if !tooOld && !tooLarge {
+			break
+		}
+
+		log.Printf("error: spool %s: evicting segment %s", s.dir, seg.name)
+		if err := os.Remove(filepath.Join(s.dir, seg.name)); err != nil {
+			return err
+		}
+
+		size -= seg.size
+	}
+
+	return nil
+}
+
+// segments returns the segments of the spool, oldest first.
+func (s *Spool) segments() ([]segment, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// ReadDir sorts by name, which is the order of writing
+	var segments []segment
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, SegmentExt) {
+			continue
+		}
+
+		ts, err := strconv.ParseInt(strings.SplitN(name, "-", 2)[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, segment{name: name, time: time.Unix(0, ts), size: info.Size()})
+	}
+
+	return segments, nil
+}
+
+// readSegment parses every line of the segment. Lines are read as by
+// metric.ReadInfluxDBWireProtocol, except that a line starting with # is
+// parsed as a datum unless it is a types comment, which is applied to the
+// datum before it.
+func readSegment(path string) ([]metric.Datum, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var data []metric.Datum
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, metric.MaxLineSize)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		types := strings.HasPrefix(line, typesPrefix)
+		if types {
+			line = strings.TrimPrefix(line, "# ")
+		}
+
+		datum, err := metric.ParseInfluxDBWireProtocol(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: line %d", filepath.Base(path), n)
+		}
+
+		if types && len(data) > 0 {
+			setFieldTypes(data[len(data)-1], datum)
+		} else if !types {
+			data = append(data, datum)
+		}
+	}
+
+	return data, errors.Wrap(scanner.Err(), filepath.Base(path))
+}
+
+// fieldTypes returns the types comment of the datum, which has a string field
+// of "duration" or "time" for each field of that type, if any.
+func fieldTypes(datum metric.Datum) (metric.Datum, bool) {
+	types := metric.Datum{Name: "types", Time: datum.Time}
+
+	for name, value := range datum.Fields {
+		var t string
+		switch value.(type) {
+		case time.Duration:
+			t = "duration"
+		case time.Time:
+			t = "time"
+		default:
+			continue
+		}
+
+		if types.Fields == nil {
+			types.Fields = make(map[string]interface{})
+		}
+
+		types.Fields[name] = t
+	}
+
+	return types, types.Fields != nil
+}
+
+// setFieldTypes converts the integer nanoseconds of the fields named in the
+// types comment back to durations or times.
+func setFieldTypes(datum metric.Datum, types metric.Datum) {
+	for name, t := range types.Fields {
+		ns, ok := datum.Fields[name].(int64)
+		if !ok {
+			continue
+		}
+
+		switch t {
+		case "duration":
+			datum.Fields[name] = time.Duration(ns)
+		case "time":
+			datum.Fields[name] = time.Unix(0, ns).UTC()
+		}
+	}
+}
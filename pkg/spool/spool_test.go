@@ -0,0 +1,179 @@
+package spool
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempSpool(t *testing.T, maxSize int64, maxAge time.Duration) (*Spool, func()) {
+	dir, err := ioutil.TempDir("", "spool")
+	require.NoError(t, err)
+
+	s, err := Open(filepath.Join(dir, "output"), maxSize, maxAge)
+	require.NoError(t, err)
+
+	return s, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func datum(name string) metric.Datum {
+	return metric.Datum{
+		Name:   name,
+		Time:   time.Unix(0, 1546398245000000000).UTC(),
+		Fields: map[string]interface{}{"f": int64(1)},
+	}
+}
+
+func TestSpool_Replay(t *testing.T) {
+	s, cleanup := tempSpool(t, 0, 0)
+	defer cleanup()
+
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.now = func() time.Time { return tm }
+
+	// durations and times keep their types, and names are not taken for
+	// comments
+	first := []metric.Datum{
+		{
+			Name: "#test",
+			Time: tm,
+			Tags: map[string]string{"t": "a b"},
+			Fields: map[string]interface{}{
+				"i":  int64(-1),
+				"u":  uint64(math.MaxUint64),
+				"f":  1.5,
+				"s":  `"x"`,
+				"d":  time.Hour,
+				"tm": tm,
+			},
+		},
+	}
+
+	require.NoError(t, s.Append(first))
+	require.NoError(t, s.Append([]metric.Datum{datum("second")}))
+
+	// a temporary file of an unfinished segment is ignored
+	require.NoError(t, ioutil.WriteFile(filepath.Join(s.dir, "1.lp.tmp"), []byte("x"), 0600))
+
+	n, err := s.Len()
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	// a failure stops the replay, and keeps the segment
+	var replayed [][]metric.Datum
+	err = s.Replay(func(data []metric.Datum) error {
+		replayed = append(replayed, data)
+		if len(replayed) == 2 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	require.EqualError(t, err, "failed")
+	require.Equal(t, [][]metric.Datum{first, {datum("second")}}, replayed)
+
+	replayed = nil
+	require.NoError(t, s.Replay(func(data []metric.Datum) error {
+		replayed = append(replayed, data)
+		return nil
+	}))
+
+	require.Equal(t, [][]metric.Datum{{datum("second")}}, replayed)
+
+	n, err = s.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
+
+func TestSpool_evict(t *testing.T) {
+	t.Run("age", func(t *testing.T) {
+		s, cleanup := tempSpool(t, 0, time.Hour)
+		defer cleanup()
+
+		tm := time.Now()
+		s.now = func() time.Time { return tm }
+
+		require.NoError(t, s.Append([]metric.Datum{datum("old")}))
+		tm = tm.Add(30 * time.Minute)
+		require.NoError(t, s.Append([]metric.Datum{datum("new")}))
+		tm = tm.Add(31 * time.Minute)
+
+		var replayed []metric.Datum
+		require.NoError(t, s.Replay(func(data []metric.Datum) error {
+			replayed = append(replayed, data...)
+			return nil
+		}))
+
+		require.Equal(t, []metric.Datum{datum("new")}, replayed)
+	})
+
+	t.Run("size", func(t *testing.T) {
+		s, cleanup := tempSpool(t, 70, 0)
+		defer cleanup()
+
+		// every segment is 31 bytes
+		for _, name := range []string{"first", "secnd", "third"} {
+			require.NoError(t, s.Append([]metric.Datum{datum(name)}))
+		}
+
+		var replayed []metric.Datum
+		require.NoError(t, s.Replay(func(data []metric.Datum) error {
+			replayed = append(replayed, data...)
+			return nil
+		}))
+
+		require.Equal(t, []metric.Datum{datum("secnd"), datum("third")}, replayed)
+	})
+}
+
+func TestSpool_Replay_unreadable(t *testing.T) {
+	s, cleanup := tempSpool(t, 0, 0)
+	defer cleanup()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(s.dir, "1-000001.lp"), []byte("invalid\n"), 0600))
+	require.NoError(t, s.Append([]metric.Datum{datum("valid")}))
+
+	var replayed []metric.Datum
+	require.NoError(t, s.Replay(func(data []metric.Datum) error {
+		replayed = append(replayed, data...)
+		return nil
+	}))
+
+	require.Equal(t, []metric.Datum{datum("valid")}, replayed)
+
+	n, err := s.Len()
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+}
+
+func TestSpool_Append_types(t *testing.T) {
+	s, cleanup := tempSpool(t, 0, 0)
+	defer cleanup()
+
+	d := datum("test")
+	d.Fields["d"] = 90 * time.Minute
+	require.NoError(t, s.Append([]metric.Datum{d}))
+
+	segments, err := s.segments()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(segments))
+
+	// the segment is in the wire protocol, with the types in a comment
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, segments[0].name))
+	require.NoError(t, err)
+	require.Equal(t, "test d=5400000000000i,f=1i 1546398245000000000\n"+
+		"# types d=\"duration\" 1546398245000000000\n", string(b))
+
+	data, err := metric.ReadInfluxDBWireProtocol(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(data))
+}
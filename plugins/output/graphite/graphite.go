@@ -0,0 +1,415 @@
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"github.com/tetratom/cloudsurvey/pkg/spool"
+	"github.com/tetratom/cloudsurvey/plugins/output/internal/remote"
+	"log"
+	"math"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	PluginName = "graphite"
+
+	DefaultAddress          = "localhost:2003"
+	DefaultTemplate         = "measurement.tags.field"
+	DefaultBatchSize        = 1000
+	DefaultFlushInterval    = 10 * time.Second
+	DefaultTimeout          = 5 * time.Second
+	DefaultMaxRetries       = 5
+	DefaultRetryInterval    = time.Second
+	DefaultMaxRetryInterval = time.Minute
+	DefaultSpoolMaxSizeMB   = 100
+	DefaultSpoolMaxAge      = 7 * 24 * time.Hour
+)
+
+func init() {
+	registry.AddOutput(
+		PluginName,
+		func() registry.Output {
+			return &Graphite{}
+		})
+}
+
+// Graphite sends data to carbon in the plaintext protocol, over TCP. Every
+// numeric field of a datum becomes a metric, whose path is given by a
+// template.
+type Graphite struct {
+	Address   string        `toml:"address"`
+	Timeout   time.Duration `toml:"timeout"`
+	Prefix    string        `toml:"prefix"`
+	Template  string        `toml:"template"`
+	Templates []string      `toml:"templates"`
+
+	BatchSize        int           `toml:"batch_size"`
+	FlushInterval    time.Duration `toml:"flush_interval"`
+	MaxRetries       *int          `toml:"max_retries"`
+	RetryInterval    time.Duration `toml:"retry_interval"`
+	MaxRetryInterval time.Duration `toml:"max_retry_interval"`
+
+	SpoolDir       string        `toml:"spool_dir"`
+	SpoolMaxSizeMB int           `toml:"spool_max_size_mb"`
+	SpoolMaxAge    time.Duration `toml:"spool_max_age"`
+
+	spool     *spool.Spool
+	retry     remote.Retry
+	template  template
+	templates []filteredTemplate
+
+	dial func(address string, timeout time.Duration) (net.Conn, error)
+	conn net.Conn
+}
+
+func (plugin *Graphite) Init() error {
+	var err error
+
+	if plugin.Address == "" {
+		plugin.Address = DefaultAddress
+	}
+
+	if plugin.Template == "" {
+		plugin.Template = DefaultTemplate
+	}
+
+	if plugin.template, err = parseTemplate(plugin.Template); err != nil {
+		return errors.Wrap(err, "template")
+	}
+
+	plugin.templates = nil
+	for i, s := range plugin.Templates {
+		parts := strings.Fields(s)
+		if len(parts) != 2 {
+			return errors.Errorf("templates[%d]: expected a filter and a template: %s", i, s)
+		}
+
+		if _, err := path.Match(parts[0], ""); err != nil {
+			return errors.Wrapf(err, "templates[%d]", i)
+		}
+
+		t, err := parseTemplate(parts[1])
+		if err != nil {
+			return errors.Wrapf(err, "templates[%d]", i)
+		}
+
+		plugin.templates = append(plugin.templates, filteredTemplate{filter: parts[0], template: t})
+	}
+
+	if plugin.Timeout == 0 {
+		plugin.Timeout = DefaultTimeout
+	}
+
+	if plugin.BatchSize <= 0 {
+		plugin.BatchSize = DefaultBatchSize
+	}
+
+	if plugin.FlushInterval == 0 {
+		plugin.FlushInterval = DefaultFlushInterval
+	}
+
+	if plugin.MaxRetries == nil {
+		maxRetries := DefaultMaxRetries
+		plugin.MaxRetries = &maxRetries
+	}
+
+	if plugin.RetryInterval == 0 {
+		plugin.RetryInterval = DefaultRetryInterval
+	}
+
+	if plugin.MaxRetryInterval == 0 {
+		plugin.MaxRetryInterval = DefaultMaxRetryInterval
+	}
+
+	if plugin.SpoolMaxSizeMB == 0 {
+		plugin.SpoolMaxSizeMB = DefaultSpoolMaxSizeMB
+	}
+
+	if plugin.SpoolMaxAge == 0 {
+		plugin.SpoolMaxAge = DefaultSpoolMaxAge
+	}
+
+	if plugin.SpoolDir != "" {
+		plugin.spool, err = spool.Open(plugin.SpoolDir, int64(plugin.SpoolMaxSizeMB)<<20, plugin.SpoolMaxAge)
+		if err != nil {
+			return errors.Wrap(err, "spool_dir")
+		}
+	}
+
+	if plugin.dial == nil {
+		plugin.dial = func(address string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("tcp", address, timeout)
+		}
+	}
+
+	plugin.retry = remote.Retry{
+		MaxRetries:  *plugin.MaxRetries,
+		Interval:    plugin.RetryInterval,
+		MaxInterval: plugin.MaxRetryInterval,
+	}
+
+	return nil
+}
+
+func (plugin *Graphite) Description() string {
+	return "sends metrics to graphite over tcp"
+}
+
+func (plugin *Graphite) DefaultConfig() string {
+	return `
+[[outputs.graphite]]
+address = "localhost:2003"
+
+## a prefix of every metric path
+# prefix = "cloudsurvey"
+
+## the path of every metric, made up of the keywords measurement, field and
+## tags, which stands for the values of all tags not named otherwise, and the
+## names of tags
+# template = "measurement.tags.field"
+
+## templates for the data whose measurement matches a filter
+# templates = [
+#   "aws_iam_user measurement.user_path.user_name.field",
+# ]
+
+# timeout = "5s"
+# batch_size = 1000
+# flush_interval = "10s"
+# max_retries = 5
+# retry_interval = "1s"
+# max_retry_interval = "1m"
+
+## a directory to keep the data that cannot be delivered in, to be sent
+## once the output recovers; every output needs its own directory
+# spool_dir = "/var/lib/cloudsurvey/spool/graphite"
+# spool_max_size_mb = 100
+# spool_max_age = "168h"`
+}
+
+// Output sends the data in batches, reconnecting whenever the connection
+// fails. A batch that cannot be sent, even after retries, is spooled if a
+// spool_dir is configured. Otherwise, it is dropped, and reported by the error
+// returned once the channel is closed.
+func (plugin *Graphite) Output(c context.Context, ch <-chan metric.Datum) error {
+	var body bytes.Buffer
+
+	defer func() {
+		if plugin.conn != nil {
+			_ = plugin.conn.Close()
+			plugin.conn = nil
+		}
+	}()
+
+	return remote.Batch(PluginName, ch, plugin.BatchSize, plugin.FlushInterval, plugin.spool, func(batch []metric.Datum) error {
+		body.Reset()
+
+		for _, datum := range batch {
+			n := body.Len()
+			if err := plugin.encode(&body, datum); err != nil {
+				log.Printf("error: output %s: %s: %+v", PluginName, datum.Name, err)
+				body.Truncate(n)
+			}
+		}
+
+		if body.Len() == 0 {
+			return nil
+		}
+
+		return plugin.retry.Do(c, PluginName, func() error {
+			return plugin.send(body.Bytes())
+		})
+	})
+}
+
+// send writes the body to the connection, which is opened first if need be.
+// The connection is closed on failure, such that the next attempt reconnects.
+func (plugin *Graphite) send(body []byte) error {
+	if plugin.conn == nil {
+		conn, err := plugin.dial(plugin.Address, plugin.Timeout)
+		if err != nil {
+			return &remote.Error{Msg: err.Error(), Temporary: true}
+		}
+
+		plugin.conn = conn
+	}
+
+	err := plugin.conn.SetWriteDeadline(time.Now().Add(plugin.Timeout))
+	if err == nil {
+		_, err = plugin.conn.Write(body)
+	}
+
+	if err != nil {
+		_ = plugin.conn.Close()
+		plugin.conn = nil
+		return &remote.Error{Msg: err.Error(), Temporary: true}
+	}
+
+	return nil
+}
+
+// encode writes a line of the form "<path> <value> <timestamp>" for every
+// numeric field of the datum, in lexical order.
+func (plugin *Graphite) encode(buf *bytes.Buffer, datum metric.Datum) error {
+	t := plugin.templateOf(datum.Name)
+
+	fields := make([]string, 0, len(datum.Fields))
+	for k := range datum.Fields {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	timestamp := strconv.FormatInt(datum.Time.Unix(), 10)
+
+	for _, field := range fields {
+		v, ok, err := metric.FloatValue(datum.Fields[field])
+		if err != nil {
+			return errors.Wrapf(err, "field %s", field)
+		}
+
+		if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+
+		if plugin.Prefix != "" {
+			buf.WriteString(plugin.Prefix)
+			buf.WriteByte('.')
+		}
+
+		buf.WriteString(t.path(datum, field))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		buf.WriteByte(' ')
+		buf.WriteString(timestamp)
+		buf.WriteByte('\n')
+	}
+
+	return nil
+}
+
+// templateOf returns the template of the first filter that matches the name
+// of a measurement, or the default template.
+func (plugin *Graphite) templateOf(name string) template {
+	for _, t := range plugin.templates {
+		if ok, _ := path.Match(t.filter, name); ok {
+			return t.template
+		}
+	}
+
+	return plugin.template
+}
+
+const (
+	keywordMeasurement = "measurement"
+	keywordField       = "field"
+	keywordTags        = "tags"
+)
+
+// template is a metric path, split on dots. Every part is either a keyword or
+// the name of a tag.
+type template struct {
+	parts []string
+
+	// named are the tags that appear in the template by name, and so are not
+	// included by the tags keyword
+	named map[string]bool
+}
+
+type filteredTemplate struct {
+	filter   string
+	template template
+}
+
+func parseTemplate(s string) (template, error) {
+	t := template{
+		parts: strings.Split(s, "."),
+		named: make(map[string]bool),
+	}
+
+	hasField := false
+	for _, part := range t.parts {
+		switch part {
+		case "":
+			return t, errors.Errorf("empty part: %s", s)
+		case keywordField:
+			hasField = true
+		case keywordMeasurement, keywordTags:
+		default:
+			t.named[part] = true
+		}
+	}
+
+	if !hasField {
+		return t, errors.Errorf("missing field: %s", s)
+	}
+
+	return t, nil
+}
+
+// path returns the path of a field of the datum. Parts that are empty, such
+// as missing tags, are left out.
+func (t template) path(datum metric.Datum, field string) string {
+	var sb strings.Builder
+
+	add := func(s string) {
+		if s == "" {
+			return
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteByte('.')
+		}
+
+		sb.WriteString(sanitize(s))
+	}
+
+	for _, part := range t.parts {
+		switch part {
+		case keywordMeasurement:
+			add(datum.Name)
+		case keywordField:
+			add(field)
+		case keywordTags:
+			keys := make([]string, 0, len(datum.Tags))
+			for k := range datum.Tags {
+				if !t.named[k] {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				add(datum.Tags[k])
+			}
+		default:
+			add(datum.Tags[part])
+		}
+	}
+
+	return sb.String()
+}
+
+// sanitize replaces the characters of a part of a path that carbon would
+// misinterpret, such as the dots in hostnames and the slashes in IAM paths,
+// with underscores. Letters, digits, and the characters - _ : are kept.
+func sanitize(s string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case c == '-', c == '_', c == ':':
+			return c
+		case unicode.IsLetter(c), unicode.IsDigit(c):
+			return c
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,153 @@
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGraphite_encode(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	datum := metric.Datum{
+		Name: "aws_iam_user",
+		Time: tm,
+		Tags: map[string]string{"account": "prod", "user_name": "alice.smith", "user_path": "/ops team/"},
+		Fields: map[string]interface{}{
+			"age":              90 * time.Second,
+			"active_key_count": 1,
+			"admin":            true,
+			"user_arn":         "arn:aws:iam::123456789012:user/alice",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		plugin Graphite
+		expect string
+	}{
+		{
+			"default",
+			Graphite{},
+			"aws_iam_user.prod.alice_smith._ops_team_.active_key_count 1 1546398245\n" +
+				"aws_iam_user.prod.alice_smith._ops_team_.admin 1 1546398245\n" +
+				"aws_iam_user.prod.alice_smith._ops_team_.age 90 1546398245\n",
+		},
+		{
+			"prefix and template",
+			Graphite{Prefix: "cloud.survey", Template: "account.measurement.tags.field"},
+			"cloud.survey.prod.aws_iam_user.alice_smith._ops_team_.active_key_count 1 1546398245\n" +
+				"cloud.survey.prod.aws_iam_user.alice_smith._ops_team_.admin 1 1546398245\n" +
+				"cloud.survey.prod.aws_iam_user.alice_smith._ops_team_.age 90 1546398245\n",
+		},
+		{
+			"filtered templates",
+			Graphite{Templates: []string{
+				"aws_ec2_* measurement.field",
+				"aws_iam_* measurement.user_name.missing.field",
+			}},
+			"aws_iam_user.alice_smith.active_key_count 1 1546398245\n" +
+				"aws_iam_user.alice_smith.admin 1 1546398245\n" +
+				"aws_iam_user.alice_smith.age 90 1546398245\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugin := test.plugin
+			require.NoError(t, plugin.Init())
+
+			var buf bytes.Buffer
+			require.NoError(t, plugin.encode(&buf, datum))
+			require.Equal(t, test.expect, buf.String())
+		})
+	}
+}
+
+func TestGraphite_Init(t *testing.T) {
+	tests := []struct {
+		plugin Graphite
+		err    string
+	}{
+		{Graphite{Template: "measurement.tags"}, "template: missing field: measurement.tags"},
+		{Graphite{Template: "measurement..field"}, "template: empty part: measurement..field"},
+		{Graphite{Templates: []string{"measurement.field"}}, "templates[0]: expected a filter and a template: measurement.field"},
+		{Graphite{Templates: []string{"[ measurement.field"}}, "templates[0]: syntax error in pattern"},
+	}
+
+	for _, test := range tests {
+		plugin := test.plugin
+		require.EqualError(t, plugin.Init(), test.err)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{"test", "test"},
+		{"i-0123:a_b", "i-0123:a_b"},
+		{"web.example.com", "web_example_com"},
+		{"/division a/team/", "_division_a_team_"},
+		{"café", "café"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expect, sanitize(test.input))
+	}
+}
+
+func TestGraphite_Output(t *testing.T) {
+	var received [][]byte
+	dials := 0
+
+	plugin := Graphite{RetryInterval: time.Millisecond}
+	plugin.dial = func(address string, timeout time.Duration) (net.Conn, error) {
+		require.Equal(t, DefaultAddress, address)
+		dials++
+
+		client, server := net.Pipe()
+		if dials == 1 {
+			// the first connection fails on write
+			_ = server.Close()
+			return client, nil
+		}
+
+		done := make(chan struct{})
+		go func() {
+			b, _ := ioutil.ReadAll(server)
+			received = append(received, b)
+			close(done)
+		}()
+
+		return &waitConn{Conn: client, done: done}, nil
+	}
+
+	require.NoError(t, plugin.Init())
+
+	ch := make(chan metric.Datum, 2)
+	ch <- metric.Datum{Name: "a", Time: time.Unix(1, 0), Fields: map[string]interface{}{"f": 1.5}}
+	ch <- metric.Datum{Name: "b", Time: time.Unix(2, 0), Fields: map[string]interface{}{"f": nil}}
+	close(ch)
+
+	require.NoError(t, plugin.Output(context.Background(), ch))
+	require.Equal(t, 2, dials)
+	require.Equal(t, [][]byte{[]byte("a.f 1.5 1\n")}, received)
+}
+
+// waitConn waits for the other end to have read everything on close.
+type waitConn struct {
+	net.Conn
+	done chan struct{}
+}
+
+func (conn *waitConn) Close() error {
+	err := conn.Conn.Close()
+	<-conn.done
+	return err
+}
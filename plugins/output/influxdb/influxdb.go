@@ -0,0 +1,280 @@
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"github.com/tetratom/cloudsurvey/pkg/spool"
+	"github.com/tetratom/cloudsurvey/plugins/output/internal/remote"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	PluginName = "influxdb"
+
+	DefaultBatchSize        = 1000
+	DefaultFlushInterval    = 10 * time.Second
+	DefaultTimeout          = 5 * time.Second
+	DefaultMaxRetries       = 5
+	DefaultRetryInterval    = time.Second
+	DefaultMaxRetryInterval = time.Minute
+	DefaultSpoolMaxSizeMB   = 100
+	DefaultSpoolMaxAge      = 7 * 24 * time.Hour
+)
+
+func init() {
+	registry.AddOutput(
+		PluginName,
+		func() registry.Output {
+			return &InfluxDB{}
+		})
+}
+
+// InfluxDB writes data to the HTTP API of InfluxDB, in batches. The v2 API is
+// used if a bucket is configured, and the v1 API otherwise.
+type InfluxDB struct {
+	URL     string        `toml:"url"`
+	Timeout time.Duration `toml:"timeout"`
+
+	Precision      string `toml:"precision"`
+	DurationFormat string `toml:"duration_format"`
+	UintSupport    bool   `toml:"uint_support"`
+
+	// v1
+	Database        string `toml:"database"`
+	RetentionPolicy string `toml:"retention_policy"`
+	Username        string `toml:"username"`
+	Password        string `toml:"password"`
+
+	// v2
+	Organization string `toml:"organization"`
+	Bucket       string `toml:"bucket"`
+	Token        string `toml:"token"`
+
+	BatchSize        int           `toml:"batch_size"`
+	FlushInterval    time.Duration `toml:"flush_interval"`
+	ContentEncoding  string        `toml:"content_encoding"`
+	MaxRetries       *int          `toml:"max_retries"`
+	RetryInterval    time.Duration `toml:"retry_interval"`
+	MaxRetryInterval time.Duration `toml:"max_retry_interval"`
+
+	SpoolDir       string        `toml:"spool_dir"`
+	SpoolMaxSizeMB int           `toml:"spool_max_size_mb"`
+	SpoolMaxAge    time.Duration `toml:"spool_max_age"`
+
+	client   *http.Client
+	spool    *spool.Spool
+	retry    remote.Retry
+	opts     metric.WireOptions
+	writeURL string
+}
+
+func (plugin *InfluxDB) Init() error {
+	if plugin.URL == "" {
+		return errors.New("url is required")
+	}
+
+	base, err := url.Parse(plugin.URL)
+	if err != nil {
+		return errors.Wrap(err, "url")
+	}
+
+	if plugin.Precision == "" {
+		plugin.Precision = "ns"
+	}
+
+	if plugin.opts.Precision, err = metric.ParsePrecision(plugin.Precision); err != nil {
+		return err
+	}
+
+	if plugin.opts.DurationFormat, err = metric.ParseDurationFormat(plugin.DurationFormat); err != nil {
+		return err
+	}
+
+	plugin.opts.Unsigned = plugin.UintSupport
+
+	query := url.Values{}
+	query.Set("precision", plugin.Precision)
+
+	if plugin.Bucket != "" {
+		if plugin.Organization == "" {
+			return errors.New("organization is required with bucket")
+		}
+
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/api/v2/write"
+		query.Set("org", plugin.Organization)
+		query.Set("bucket", plugin.Bucket)
+	} else {
+		if plugin.Database == "" {
+			return errors.New("either database or bucket is required")
+		}
+
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/write"
+		query.Set("db", plugin.Database)
+		if plugin.RetentionPolicy != "" {
+			query.Set("rp", plugin.RetentionPolicy)
+		}
+	}
+
+	base.RawQuery = query.Encode()
+	plugin.writeURL = base.String()
+
+	switch plugin.ContentEncoding {
+	case "":
+		plugin.ContentEncoding = "gzip"
+	case "gzip", "identity":
+	default:
+		return errors.Errorf("unknown content_encoding: %s", plugin.ContentEncoding)
+	}
+
+	if plugin.Timeout == 0 {
+		plugin.Timeout = DefaultTimeout
+	}
+
+	if plugin.BatchSize <= 0 {
+		plugin.BatchSize = DefaultBatchSize
+	}
+
+	if plugin.FlushInterval == 0 {
+		plugin.FlushInterval = DefaultFlushInterval
+	}
+
+	if plugin.MaxRetries == nil {
+		maxRetries := DefaultMaxRetries
+		plugin.MaxRetries = &maxRetries
+	}
+
+	if plugin.RetryInterval == 0 {
+		plugin.RetryInterval = DefaultRetryInterval
+	}
+
+	if plugin.MaxRetryInterval == 0 {
+		plugin.MaxRetryInterval = DefaultMaxRetryInterval
+	}
+
+	if plugin.SpoolMaxSizeMB == 0 {
+		plugin.SpoolMaxSizeMB = DefaultSpoolMaxSizeMB
+	}
+
+	if plugin.SpoolMaxAge == 0 {
+		plugin.SpoolMaxAge = DefaultSpoolMaxAge
+	}
+
+	if plugin.SpoolDir != "" {
+		var err error
+		plugin.spool, err = spool.Open(plugin.SpoolDir, int64(plugin.SpoolMaxSizeMB)<<20, plugin.SpoolMaxAge)
+		if err != nil {
+			return errors.Wrap(err, "spool_dir")
+		}
+	}
+
+	plugin.client = &http.Client{Timeout: plugin.Timeout}
+	plugin.retry = remote.Retry{
+		MaxRetries:  *plugin.MaxRetries,
+		Interval:    plugin.RetryInterval,
+		MaxInterval: plugin.MaxRetryInterval,
+	}
+
+	return nil
+}
+
+func (plugin *InfluxDB) Description() string {
+	return "writes metrics to the http api of influxdb"
+}
+
+func (plugin *InfluxDB) DefaultConfig() string {
+	return `
+[[outputs.influxdb]]
+url = "http://localhost:8086"
+
+## influxdb 1.x
+database = "cloudsurvey"
+# retention_policy = ""
+# username = ""
+# password = ""
+
+## influxdb 2.x, used instead of the above if a bucket is given
+# organization = ""
+# bucket = ""
+# token = ""
+
+## the unit of timestamps: s, ms, us or ns
+# precision = "ns"
+
+## the representation of durations: "ns" for integer nanoseconds, "s" for
+## integer seconds, or "float_s" for seconds
+# duration_format = "ns"
+
+## write unsigned integers with the u suffix of influxdb 1.4 and later
+# uint_support = false
+
+# timeout = "5s"
+# batch_size = 1000
+# flush_interval = "10s"
+# content_encoding = "gzip"
+# max_retries = 5
+# retry_interval = "1s"
+# max_retry_interval = "1m"
+
+## a directory to keep the data that cannot be delivered in, to be sent
+## once the output recovers; every output needs its own directory
+# spool_dir = "/var/lib/cloudsurvey/spool/influxdb"
+# spool_max_size_mb = 100
+# spool_max_age = "168h"`
+}
+
+// Output writes the data in batches. A batch that cannot be written, even
+// after retries, is spooled if a spool_dir is configured. Otherwise, it is
+// dropped, and reported by the error returned once the channel is closed.
+func (plugin *InfluxDB) Output(c context.Context, ch <-chan metric.Datum) error {
+	var body bytes.Buffer
+	enc := metric.NewEncoder(&body, metric.FormatInfluxDB, plugin.opts)
+
+	return remote.Batch(PluginName, ch, plugin.BatchSize, plugin.FlushInterval, plugin.spool, func(batch []metric.Datum) error {
+		body.Reset()
+
+		for _, datum := range batch {
+			if err := enc.Encode(datum); err != nil {
+				log.Printf("error: output %s: %s: %+v", PluginName, datum.Name, err)
+			}
+		}
+
+		return plugin.write(c, body.Bytes())
+	})
+}
+
+// write sends the body, retrying transient failures.
+func (plugin *InfluxDB) write(c context.Context, body []byte) error {
+	if plugin.ContentEncoding == "gzip" {
+		var err error
+		if body, err = remote.Gzip(body); err != nil {
+			return err
+		}
+	}
+
+	return plugin.retry.Do(c, PluginName, func() error {
+		req, err := http.NewRequest(http.MethodPost, plugin.writeURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if plugin.ContentEncoding == "gzip" {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		if plugin.Token != "" {
+			req.Header.Set("Authorization", "Token "+plugin.Token)
+		} else if plugin.Username != "" {
+			req.SetBasicAuth(plugin.Username, plugin.Password)
+		}
+
+		return remote.Post(c, plugin.client, req)
+	})
+}
@@ -0,0 +1,278 @@
+package influxdb
+
+import (
+	"compress/gzip"
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// server is a stand-in for InfluxDB, which responds with the given statuses
+// in turn, and then with 204.
+type server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	statuses []int
+}
+
+func newServer(t *testing.T, statuses ...int) *server {
+	s := &server{statuses: statuses}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = gz
+		}
+
+		b, err := ioutil.ReadAll(body)
+		require.NoError(t, err)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, string(b))
+
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "0")
+		}
+
+		w.WriteHeader(status)
+	}))
+
+	return s
+}
+
+func datum(i int) metric.Datum {
+	return metric.Datum{
+		Name:   "test",
+		Time:   time.Unix(0, int64(i)),
+		Fields: map[string]interface{}{"i": i},
+	}
+}
+
+func send(n int) <-chan metric.Datum {
+	ch := make(chan metric.Datum, n)
+	for i := 0; i < n; i++ {
+		ch <- datum(i)
+	}
+	close(ch)
+	return ch
+}
+
+func TestInfluxDB_Output(t *testing.T) {
+	t.Run("v1", func(t *testing.T) {
+		s := newServer(t)
+		defer s.Close()
+
+		plugin := InfluxDB{
+			URL:             s.URL,
+			Database:        "db",
+			RetentionPolicy: "rp",
+			Username:        "user",
+			Password:        "pass",
+			BatchSize:       2,
+		}
+		require.NoError(t, plugin.Init())
+		require.NoError(t, plugin.Output(context.Background(), send(3)))
+
+		require.Equal(t, 2, len(s.requests))
+		require.Equal(t, "/write", s.requests[0].URL.Path)
+		require.Equal(t, "db=db&precision=ns&rp=rp", s.requests[0].URL.RawQuery)
+		user, pass, ok := s.requests[0].BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "user", user)
+		require.Equal(t, "pass", pass)
+		require.Equal(t, "gzip", s.requests[0].Header.Get("Content-Encoding"))
+		require.Equal(t, []string{"test i=0i 0\ntest i=1i 1\n", "test i=2i 2\n"}, s.bodies)
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		s := newServer(t)
+		defer s.Close()
+
+		plugin := InfluxDB{
+			URL:             s.URL + "/",
+			Organization:    "org",
+			Bucket:          "bucket",
+			Token:           "secret",
+			ContentEncoding: "identity",
+		}
+		require.NoError(t, plugin.Init())
+		require.NoError(t, plugin.Output(context.Background(), send(3)))
+
+		require.Equal(t, 1, len(s.requests))
+		require.Equal(t, "/api/v2/write", s.requests[0].URL.Path)
+		require.Equal(t, "bucket=bucket&org=org&precision=ns", s.requests[0].URL.RawQuery)
+		require.Equal(t, "Token secret", s.requests[0].Header.Get("Authorization"))
+		require.Equal(t, "", s.requests[0].Header.Get("Content-Encoding"))
+		require.Equal(t, []string{"test i=0i 0\ntest i=1i 1\ntest i=2i 2\n"}, s.bodies)
+	})
+
+	t.Run("precision", func(t *testing.T) {
+		s := newServer(t)
+		defer s.Close()
+
+		plugin := InfluxDB{URL: s.URL, Database: "db", Precision: "s", DurationFormat: "float_s"}
+		require.NoError(t, plugin.Init())
+
+		ch := make(chan metric.Datum, 1)
+		ch <- metric.Datum{
+			Name:   "test",
+			Time:   time.Unix(1546398245, 123),
+			Fields: map[string]interface{}{"age": 1500 * time.Millisecond},
+		}
+		close(ch)
+
+		require.NoError(t, plugin.Output(context.Background(), ch))
+		require.Equal(t, "db=db&precision=s", s.requests[0].URL.RawQuery)
+		require.Equal(t, []string{"test age=1.5 1546398245\n"}, s.bodies)
+	})
+
+	t.Run("flush interval", func(t *testing.T) {
+		s := newServer(t)
+		defer s.Close()
+
+		plugin := InfluxDB{URL: s.URL, Database: "db", FlushInterval: 10 * time.Millisecond}
+		require.NoError(t, plugin.Init())
+
+		ch := make(chan metric.Datum)
+		done := make(chan error)
+		go func() {
+			done <- plugin.Output(context.Background(), ch)
+		}()
+
+		ch <- datum(0)
+		time.Sleep(100 * time.Millisecond)
+		s.mu.Lock()
+		require.Equal(t, 1, len(s.requests))
+		s.mu.Unlock()
+
+		close(ch)
+		require.NoError(t, <-done)
+		require.Equal(t, 1, len(s.requests))
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		s := newServer(t, http.StatusServiceUnavailable, http.StatusInternalServerError)
+		defer s.Close()
+
+		plugin := InfluxDB{URL: s.URL, Database: "db", RetryInterval: time.Millisecond}
+		require.NoError(t, plugin.Init())
+		require.NoError(t, plugin.Output(context.Background(), send(1)))
+		require.Equal(t, 3, len(s.requests))
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		s := newServer(t, 500, 500, 500)
+		defer s.Close()
+
+		maxRetries := 1
+		plugin := InfluxDB{URL: s.URL, Database: "db", MaxRetries: &maxRetries, RetryInterval: time.Millisecond}
+		require.NoError(t, plugin.Init())
+		require.EqualError(t, plugin.Output(context.Background(), send(1)), "dropped 1 data")
+		require.Equal(t, 2, len(s.requests))
+	})
+
+	t.Run("permanent failure", func(t *testing.T) {
+		s := newServer(t, http.StatusBadRequest)
+		defer s.Close()
+
+		plugin := InfluxDB{URL: s.URL, Database: "db", BatchSize: 2}
+		require.NoError(t, plugin.Init())
+		require.EqualError(t, plugin.Output(context.Background(), send(3)), "dropped 2 data")
+		require.Equal(t, 2, len(s.requests))
+	})
+
+	t.Run("spool", func(t *testing.T) {
+		s := newServer(t, 500, 500)
+		defer s.Close()
+
+		dir, err := ioutil.TempDir("", "spool")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		// the first run fails, and spools the datum
+		maxRetries := 1
+		plugin := InfluxDB{URL: s.URL, Database: "db", DurationFormat: "s", MaxRetries: &maxRetries, RetryInterval: time.Millisecond, SpoolDir: dir}
+		require.NoError(t, plugin.Init())
+
+		ch := make(chan metric.Datum, 1)
+		ch <- metric.Datum{Name: "test", Time: time.Unix(0, 0), Fields: map[string]interface{}{"d": time.Hour}}
+		close(ch)
+
+		require.NoError(t, plugin.Output(context.Background(), ch))
+		require.Equal(t, 2, len(s.requests))
+
+		// the next run replays it first, with the duration in seconds
+		plugin = InfluxDB{URL: s.URL, Database: "db", DurationFormat: "s", SpoolDir: dir}
+		require.NoError(t, plugin.Init())
+
+		ch = make(chan metric.Datum, 1)
+		ch <- datum(1)
+		close(ch)
+
+		require.NoError(t, plugin.Output(context.Background(), ch))
+		require.Equal(t, []string{"test d=3600i 0\n", "test i=1i 1\n"}, s.bodies[2:])
+	})
+}
+
+func TestInfluxDB_Init(t *testing.T) {
+	tests := []struct {
+		plugin InfluxDB
+		err    string
+	}{
+		{InfluxDB{Database: "db"}, "url is required"},
+		{InfluxDB{URL: "http://localhost:8086"}, "either database or bucket is required"},
+		{InfluxDB{URL: "http://localhost:8086", Bucket: "b"}, "organization is required with bucket"},
+		{InfluxDB{URL: "http://localhost:8086", Database: "db", ContentEncoding: "br"}, "unknown content_encoding: br"},
+		{InfluxDB{URL: "http://localhost:8086", Database: "db", Precision: "h"}, "unknown precision: h"},
+		{InfluxDB{URL: "http://localhost:8086", Database: "db", DurationFormat: "h"}, "unknown duration format: h"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err, func(t *testing.T) {
+			require.EqualError(t, test.plugin.Init(), test.err)
+		})
+	}
+}
+
+func TestInfluxDB_UintSupport(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+
+	for _, uintSupport := range []bool{false, true} {
+		plugin := InfluxDB{URL: s.URL, Database: "db", UintSupport: uintSupport}
+		require.NoError(t, plugin.Init())
+
+		ch := make(chan metric.Datum, 2)
+		ch <- metric.Datum{Name: "test", Time: time.Unix(0, 0), Fields: map[string]interface{}{"f": uint64(1)}}
+		ch <- metric.Datum{Name: "test", Time: time.Unix(0, 0), Fields: map[string]interface{}{"f": uint64(1 << 63)}}
+		close(ch)
+
+		require.NoError(t, plugin.Output(context.Background(), ch))
+	}
+
+	// the datum that overflows is skipped without unsigned integers
+	require.Equal(t, []string{
+		"test f=1i 0\n",
+		"test f=1u 0\ntest f=9223372036854775808u 0\n",
+	}, s.bodies)
+}
@@ -0,0 +1,280 @@
+// Package remote provides the batching and retries shared by the outputs that
+// deliver data over the network.
+package remote
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/spool"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Batch passes the data received from the channel to write, in batches of up
+// to size data, or once interval has passed since the first datum of a batch.
+// A batch that cannot be written for a temporary reason, as told by
+// Temporary, is appended to the spool, if any. Other failed batches are
+// dropped, and must not be retained by write either way. Spooled data are
+// replayed before the next batch is written, and a batch is spooled right
+// away while the spool cannot be replayed, such that data are written in
+// order. Spooled data that are rejected for good on replay are dropped, so
+// that they do not hold back the rest. Once the channel is closed, the last
+// batch is written, and an error is returned if any data were dropped.
+func Batch(name string, ch <-chan metric.Datum, size int, interval time.Duration, sp *spool.Spool, write func([]metric.Datum) error) error {
+	var (
+		batch   []metric.Datum
+		dropped int
+		timer   *time.Timer
+		timerC  <-chan time.Time
+	)
+
+	replay := func() bool {
+		if sp == nil {
+			return true
+		}
+
+		err := sp.Replay(func(data []metric.Datum) error {
+			err := write(data)
+			if err != nil && !Temporary(err) {
+				log.Printf("error: output %s: dropped %d spooled data: %+v", name, len(data), err)
+				dropped += len(data)
+				return nil
+			}
+
+			return err
+		})
+
+		if err != nil {
+			log.Printf("error: output %s: replaying spool: %+v", name, err)
+			return false
+		}
+
+		return true
+	}
+
+	// store spools the batch, unless it failed for good, or else drops it
+	store := func(err error) {
+		if sp == nil || (err != nil && !Temporary(err)) {
+			log.Printf("error: output %s: dropped %d data: %+v", name, len(batch), err)
+			dropped += len(batch)
+			return
+		}
+
+		if err != nil {
+			log.Printf("error: output %s: %+v", name, err)
+		}
+
+		if err := sp.Append(batch); err != nil {
+			log.Printf("error: output %s: dropped %d data: spool: %+v", name, len(batch), err)
+			dropped += len(batch)
+			return
+		}
+
+		log.Printf("output %s: spooled %d data", name, len(batch))
+	}
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timerC = nil, nil
+		}
+
+		if len(batch) == 0 {
+			return
+		}
+
+		if !replay() {
+			store(nil)
+		} else if err := write(batch); err != nil {
+			store(err)
+		}
+
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case datum, ok := <-ch:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				} else {
+					replay()
+				}
+
+				if dropped > 0 {
+					return errors.Errorf("dropped %d data", dropped)
+				}
+
+				return nil
+			}
+
+			batch = append(batch, datum)
+
+			if len(batch) == 1 {
+				timer = time.NewTimer(interval)
+				timerC = timer.C
+			}
+
+			if len(batch) >= size {
+				flush()
+			}
+		case <-timerC:
+			flush()
+		}
+	}
+}
+
+// Error is a failure to deliver data, which may be worth retrying.
+type Error struct {
+	Msg       string
+	Temporary bool
+
+	// RetryAfter is the delay requested by the server, if any.
+	RetryAfter time.Duration
+}
+
+func (err *Error) Error() string {
+	return err.Msg
+}
+
+// Temporary returns whether err is caused by a temporary *Error, such that
+// the delivery may succeed later.
+func Temporary(err error) bool {
+	rerr, ok := errors.Cause(err).(*Error)
+	return ok && rerr.Temporary
+}
+
+// Retry describes how often, and when, to retry a failed delivery.
+type Retry struct {
+	MaxRetries  int
+	Interval    time.Duration
+	MaxInterval time.Duration
+}
+
+// Do invokes f until it succeeds, or fails with an error that is not a
+// temporary *Error, or MaxRetries retries have been made. The delay before a
+// retry doubles from Interval up to MaxInterval, unless the error specifies a
+// RetryAfter, which is also limited to MaxInterval.
+func (retry Retry) Do(c context.Context, name string, f func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		rerr, ok := err.(*Error)
+		if !ok || !rerr.Temporary || attempt >= retry.MaxRetries {
+			return err
+		}
+
+		delay := rerr.RetryAfter
+		if delay == 0 {
+			delay = Backoff(retry.Interval, retry.MaxInterval, attempt)
+		} else if delay > retry.MaxInterval {
+			delay = retry.MaxInterval
+		}
+
+		log.Printf("output %s: %s, retrying in %s", name, err, delay)
+
+		select {
+		case <-c.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Post sends the request, and returns an *Error unless the response has a
+// 2xx status. Network errors, and responses with a 429, 500, 502, 503 or 504
+// status are temporary.
+func Post(c context.Context, client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req.WithContext(c))
+	if err != nil {
+		// temporary even if the context is done, such that the batch is
+		// spooled rather than dropped; Retry.Do stops retrying regardless
+		return &Error{Msg: err.Error(), Temporary: true}
+	}
+
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	rerr := Error{
+		Msg: fmt.Sprintf("%s: %s", resp.Status, strings.TrimSpace(string(b))),
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		rerr.Temporary = true
+		rerr.RetryAfter = ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		rerr.Temporary = true
+	}
+
+	return &rerr
+}
+
+// Gzip compresses the body.
+func Gzip(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ParseRetryAfter returns the delay given by a Retry-After header, either in
+// seconds or as a date, or zero if there is none.
+func ParseRetryAfter(s string, now time.Time) time.Duration {
+	if s == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(s); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(s); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+// Backoff returns the delay before the given retry, doubling from interval up
+// to max.
+func Backoff(interval, max time.Duration, attempt int) time.Duration {
+	delay := interval
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
@@ -0,0 +1,267 @@
+package remote
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/spool"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	send := func(n int) <-chan metric.Datum {
+		ch := make(chan metric.Datum, n)
+		for i := 0; i < n; i++ {
+			ch <- metric.Datum{Name: "test"}
+		}
+		close(ch)
+		return ch
+	}
+
+	t.Run("size", func(t *testing.T) {
+		var sizes []int
+		err := Batch("test", send(5), 2, time.Hour, nil, func(batch []metric.Datum) error {
+			sizes = append(sizes, len(batch))
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []int{2, 2, 1}, sizes)
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		ch := make(chan metric.Datum)
+		flushed := make(chan int, 1)
+
+		go func() {
+			ch <- metric.Datum{Name: "test"}
+			require.Equal(t, 1, <-flushed)
+			close(ch)
+		}()
+
+		err := Batch("test", ch, 10, 10*time.Millisecond, nil, func(batch []metric.Datum) error {
+			flushed <- len(batch)
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		n := 0
+		err := Batch("test", send(5), 2, time.Hour, nil, func(batch []metric.Datum) error {
+			if n++; n == 2 {
+				return errors.New("failed")
+			}
+			return nil
+		})
+
+		require.EqualError(t, err, "dropped 2 data")
+	})
+
+	t.Run("spooled", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "spool")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		sp, err := spool.Open(dir, 0, 0)
+		require.NoError(t, err)
+
+		ch := make(chan metric.Datum, 5)
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			ch <- metric.Datum{Name: name, Fields: map[string]interface{}{"f": int64(1)}}
+		}
+		close(ch)
+
+		// the second batch fails, and is replayed before the last one
+		var written []string
+		n := 0
+		err = Batch("test", ch, 2, time.Hour, sp, func(batch []metric.Datum) error {
+			if n++; n == 2 {
+				return &Error{Msg: "failed", Temporary: true}
+			}
+
+			for _, datum := range batch {
+				written = append(written, datum.Name)
+			}
+			return nil
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b", "c", "d", "e"}, written)
+
+		segments, err := sp.Len()
+		require.NoError(t, err)
+		require.Equal(t, 0, segments)
+	})
+
+	t.Run("permanent error then good batch", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "spool")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		sp, err := spool.Open(dir, 0, 0)
+		require.NoError(t, err)
+
+		// a permanent rejection is dropped rather than spooled
+		var written []string
+		err = Batch("test", send(3), 1, time.Hour, sp, func(batch []metric.Datum) error {
+			if len(written) == 0 {
+				written = append(written, "rejected")
+				return errors.Wrap(&Error{Msg: "400 Bad Request"}, "write")
+			}
+
+			written = append(written, batch[0].Name)
+			return nil
+		})
+
+		require.EqualError(t, err, "dropped 1 data")
+		require.Equal(t, []string{"rejected", "test", "test"}, written)
+
+		segments, err := sp.Len()
+		require.NoError(t, err)
+		require.Equal(t, 0, segments)
+
+		// a spooled batch that is rejected for good on replay is dropped too
+		require.NoError(t, sp.Append([]metric.Datum{{Name: "spooled", Fields: map[string]interface{}{"f": int64(1)}}}))
+
+		written = nil
+		err = Batch("test", send(2), 1, time.Hour, sp, func(batch []metric.Datum) error {
+			if batch[0].Name == "spooled" {
+				return &Error{Msg: "400 Bad Request"}
+			}
+
+			written = append(written, batch[0].Name)
+			return nil
+		})
+
+		require.EqualError(t, err, "dropped 1 data")
+		require.Equal(t, []string{"test", "test"}, written)
+
+		segments, err = sp.Len()
+		require.NoError(t, err)
+		require.Equal(t, 0, segments)
+	})
+}
+
+func TestRetry_Do(t *testing.T) {
+	retry := Retry{MaxRetries: 2, Interval: time.Millisecond, MaxInterval: time.Millisecond}
+
+	tests := []struct {
+		name   string
+		err    error
+		calls  int
+		failed bool
+	}{
+		{"success", nil, 1, false},
+		{"temporary", &Error{Msg: "failed", Temporary: true}, 3, true},
+		{"permanent", &Error{Msg: "failed"}, 1, true},
+		{"other", errors.New("failed"), 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			err := retry.Do(context.Background(), "test", func() error {
+				calls++
+				return test.err
+			})
+
+			require.Equal(t, test.calls, calls)
+			require.Equal(t, test.failed, err != nil)
+		})
+	}
+
+	t.Run("retry after", func(t *testing.T) {
+		calls := 0
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer s.Close()
+
+		c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := retry.Do(c, "test", func() error {
+			req, err := http.NewRequest(http.MethodPost, s.URL, nil)
+			require.NoError(t, err)
+			return Post(c, http.DefaultClient, req)
+		})
+
+		require.Error(t, err)
+		require.NoError(t, c.Err())
+		require.Equal(t, 3, calls)
+	})
+}
+
+func TestPost(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		expect     *Error
+	}{
+		{http.StatusNoContent, "", nil},
+		{http.StatusBadRequest, "", &Error{Msg: "400 Bad Request: body"}},
+		{http.StatusInternalServerError, "", &Error{Msg: "500 Internal Server Error: body", Temporary: true}},
+		{http.StatusTooManyRequests, "3", &Error{Msg: "429 Too Many Requests: body", Temporary: true, RetryAfter: 3 * time.Second}},
+	}
+
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.retryAfter != "" {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte("body\n"))
+			}))
+			defer s.Close()
+
+			req, err := http.NewRequest(http.MethodPost, s.URL, nil)
+			require.NoError(t, err)
+
+			err = Post(context.Background(), http.DefaultClient, req)
+			if test.expect == nil {
+				require.NoError(t, err)
+			} else {
+				require.Equal(t, test.expect, err)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		input  string
+		expect time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"-1", 0},
+		{"120", 2 * time.Minute},
+		{"Wed, 02 Jan 2019 03:04:35 GMT", 30 * time.Second},
+		{"Wed, 02 Jan 2019 03:04:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			require.Equal(t, test.expect, ParseRetryAfter(test.input, now))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, expect := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		require.Equal(t, expect*time.Second, Backoff(time.Second, 10*time.Second, attempt))
+	}
+}
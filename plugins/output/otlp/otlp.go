@@ -0,0 +1,436 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"github.com/tetratom/cloudsurvey/pkg/spool"
+	"github.com/tetratom/cloudsurvey/plugins/output/internal/remote"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	PluginName = "otlp"
+
+	// ScopeName is the name of the instrumentation scope of all metrics.
+	ScopeName = "cloudsurvey"
+
+	DefaultURL              = "http://localhost:4318/v1/metrics"
+	DefaultBatchSize        = 1000
+	DefaultFlushInterval    = 10 * time.Second
+	DefaultTimeout          = 5 * time.Second
+	DefaultMaxRetries       = 5
+	DefaultRetryInterval    = time.Second
+	DefaultMaxRetryInterval = time.Minute
+	DefaultSpoolMaxSizeMB   = 100
+	DefaultSpoolMaxAge      = 7 * 24 * time.Hour
+)
+
+func init() {
+	registry.AddOutput(
+		PluginName,
+		func() registry.Output {
+			return &OTLP{}
+		})
+}
+
+// OTLP exports data as OpenTelemetry gauges over OTLP/HTTP, encoded as
+// protobuf. Every field of a datum becomes a metric named <datum>.<field>.
+type OTLP struct {
+	URL     string            `toml:"url"`
+	Headers map[string]string `toml:"headers"`
+	Timeout time.Duration     `toml:"timeout"`
+
+	BatchSize        int           `toml:"batch_size"`
+	FlushInterval    time.Duration `toml:"flush_interval"`
+	ContentEncoding  string        `toml:"content_encoding"`
+	MaxRetries       *int          `toml:"max_retries"`
+	RetryInterval    time.Duration `toml:"retry_interval"`
+	MaxRetryInterval time.Duration `toml:"max_retry_interval"`
+
+	SpoolDir       string        `toml:"spool_dir"`
+	SpoolMaxSizeMB int           `toml:"spool_max_size_mb"`
+	SpoolMaxAge    time.Duration `toml:"spool_max_age"`
+
+	client       *http.Client
+	spool        *spool.Spool
+	retry        remote.Retry
+	resourceTags map[string]bool
+}
+
+func (plugin *OTLP) SetResourceTags(names []string) {
+	plugin.resourceTags = make(map[string]bool)
+	for _, name := range names {
+		plugin.resourceTags[name] = true
+	}
+}
+
+func (plugin *OTLP) Init() error {
+	if plugin.URL == "" {
+		plugin.URL = DefaultURL
+	}
+
+	if _, err := url.Parse(plugin.URL); err != nil {
+		return errors.Wrap(err, "url")
+	}
+
+	switch plugin.ContentEncoding {
+	case "":
+		plugin.ContentEncoding = "gzip"
+	case "gzip", "identity":
+	default:
+		return errors.Errorf("unknown content_encoding: %s", plugin.ContentEncoding)
+	}
+
+	if plugin.Timeout == 0 {
+		plugin.Timeout = DefaultTimeout
+	}
+
+	if plugin.BatchSize <= 0 {
+		plugin.BatchSize = DefaultBatchSize
+	}
+
+	if plugin.FlushInterval == 0 {
+		plugin.FlushInterval = DefaultFlushInterval
+	}
+
+	if plugin.MaxRetries == nil {
+		maxRetries := DefaultMaxRetries
+		plugin.MaxRetries = &maxRetries
+	}
+
+	if plugin.RetryInterval == 0 {
+		plugin.RetryInterval = DefaultRetryInterval
+	}
+
+	if plugin.MaxRetryInterval == 0 {
+		plugin.MaxRetryInterval = DefaultMaxRetryInterval
+	}
+
+	if plugin.SpoolMaxSizeMB == 0 {
+		plugin.SpoolMaxSizeMB = DefaultSpoolMaxSizeMB
+	}
+
+	if plugin.SpoolMaxAge == 0 {
+		plugin.SpoolMaxAge = DefaultSpoolMaxAge
+	}
+
+	if plugin.SpoolDir != "" {
+		var err error
+		plugin.spool, err = spool.Open(plugin.SpoolDir, int64(plugin.SpoolMaxSizeMB)<<20, plugin.SpoolMaxAge)
+		if err != nil {
+			return errors.Wrap(err, "spool_dir")
+		}
+	}
+
+	plugin.client = &http.Client{Timeout: plugin.Timeout}
+	plugin.retry = remote.Retry{
+		MaxRetries:  *plugin.MaxRetries,
+		Interval:    plugin.RetryInterval,
+		MaxInterval: plugin.MaxRetryInterval,
+	}
+
+	return nil
+}
+
+func (plugin *OTLP) Description() string {
+	return "exports metrics over otlp/http"
+}
+
+func (plugin *OTLP) DefaultConfig() string {
+	return `
+[[outputs.otlp]]
+url = "http://localhost:4318/v1/metrics"
+
+## additional headers of every request, e.g. for authentication
+# headers = { Authorization = "Bearer ${OTLP_TOKEN}" }
+
+# timeout = "5s"
+# batch_size = 1000
+# flush_interval = "10s"
+# content_encoding = "gzip"
+# max_retries = 5
+# retry_interval = "1s"
+# max_retry_interval = "1m"
+
+## a directory to keep the data that cannot be delivered in, to be sent
+## once the output recovers; every output needs its own directory
+# spool_dir = "/var/lib/cloudsurvey/spool/otlp"
+# spool_max_size_mb = 100
+# spool_max_age = "168h"`
+}
+
+// Output exports the data in batches. A batch that cannot be exported, even
+// after retries, is spooled if a spool_dir is configured. Otherwise, it is
+// dropped, and reported by the error returned once the channel is closed.
+func (plugin *OTLP) Output(c context.Context, ch <-chan metric.Datum) error {
+	return remote.Batch(PluginName, ch, plugin.BatchSize, plugin.FlushInterval, plugin.spool, func(batch []metric.Datum) error {
+		return plugin.export(c, plugin.encode(batch))
+	})
+}
+
+// export sends the body, retrying transient failures.
+func (plugin *OTLP) export(c context.Context, body []byte) error {
+	if plugin.ContentEncoding == "gzip" {
+		var err error
+		if body, err = remote.Gzip(body); err != nil {
+			return err
+		}
+	}
+
+	return plugin.retry.Do(c, PluginName, func() error {
+		req, err := http.NewRequest(http.MethodPost, plugin.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		for k, v := range plugin.Headers {
+			req.Header.Set(k, v)
+		}
+
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		if plugin.ContentEncoding == "gzip" {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		return remote.Post(c, plugin.client, req)
+	})
+}
+
+type resourceMetrics struct {
+	attributes map[string]string
+	metrics    map[string]*gauge
+}
+
+type gauge struct {
+	unit   string
+	points []point
+}
+
+type point struct {
+	attributes map[string]string
+	time       time.Time
+	isDouble   bool
+	asInt      int64
+	asDouble   float64
+}
+
+// encode encodes the data as an ExportMetricsServiceRequest. The tags that
+// identify the resource become the attributes of the resource, and the
+// others the attributes of the data points. Fields that are not numeric are
+// skipped.
+func (plugin *OTLP) encode(data []metric.Datum) []byte {
+	var resources []*resourceMetrics
+	byKey := make(map[string]*resourceMetrics)
+
+	for _, datum := range data {
+		resourceAttributes := make(map[string]string)
+		pointAttributes := make(map[string]string)
+
+		for k, v := range datum.Tags {
+			if plugin.resourceTags[k] {
+				resourceAttributes[k] = v
+			} else {
+				pointAttributes[k] = v
+			}
+		}
+
+		key := attributesKey(resourceAttributes)
+		resource, ok := byKey[key]
+		if !ok {
+			resource = &resourceMetrics{
+				attributes: resourceAttributes,
+				metrics:    make(map[string]*gauge),
+			}
+			resources = append(resources, resource)
+			byKey[key] = resource
+		}
+
+		for field, value := range datum.Fields {
+			p := point{attributes: pointAttributes, time: datum.Time}
+
+			unit, ok, err := p.setValue(value)
+			if err != nil {
+				log.Printf("error: output %s: %s: %s: %+v", PluginName, datum.Name, field, err)
+				continue
+			}
+
+			if !ok {
+				continue
+			}
+
+			name := datum.Name + "." + field
+			g, ok := resource.metrics[name]
+			if !ok {
+				g = &gauge{unit: unit}
+				resource.metrics[name] = g
+			}
+
+			g.points = append(g.points, p)
+		}
+	}
+
+	var buf protoBuffer
+	for _, resource := range resources {
+		resource := resource
+
+		// ExportMetricsServiceRequest.resource_metrics
+		buf.message(1, func(buf *protoBuffer) {
+			// ResourceMetrics.resource
+			buf.message(1, func(buf *protoBuffer) {
+				encodeAttributes(buf, 1, resource.attributes)
+			})
+
+			// ResourceMetrics.scope_metrics
+			buf.message(2, func(buf *protoBuffer) {
+				buf.message(1, func(buf *protoBuffer) {
+					buf.string(1, ScopeName)
+				})
+
+				names := make([]string, 0, len(resource.metrics))
+				for name := range resource.metrics {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					encodeGauge(buf, name, resource.metrics[name])
+				}
+			})
+		})
+	}
+
+	return buf.b
+}
+
+// setValue sets the value of the point from that of a field, and returns its
+// unit. Durations are given in seconds, times in seconds since the epoch, and
+// bools as 0 or 1. Returns false for values that have no numeric
+// representation.
+func (p *point) setValue(value interface{}) (string, bool, error) {
+	switch v := value.(type) {
+	case int:
+		p.asInt = int64(v)
+	case int8:
+		p.asInt = int64(v)
+	case int16:
+		p.asInt = int64(v)
+	case int32:
+		p.asInt = int64(v)
+	case int64:
+		p.asInt = v
+	case uint:
+		return p.setValue(uint64(v))
+	case uint8:
+		p.asInt = int64(v)
+	case uint16:
+		p.asInt = int64(v)
+	case uint32:
+		p.asInt = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			p.isDouble, p.asDouble = true, float64(v)
+		} else {
+			p.asInt = int64(v)
+		}
+	case float32:
+		p.isDouble, p.asDouble = true, float64(v)
+	case float64:
+		p.isDouble, p.asDouble = true, v
+	case bool:
+		if v {
+			p.asInt = 1
+		}
+	case time.Duration:
+		p.isDouble, p.asDouble = true, v.Seconds()
+		return "s", true, nil
+	case time.Time:
+		p.isDouble, p.asDouble = true, float64(v.UnixNano())/1e9
+		return "s", true, nil
+	case string, fmt.Stringer:
+		return "", false, nil
+	case nil:
+		return "", false, errors.New("field value is nil")
+	default:
+		return "", false, errors.Errorf("unknown field type: %s", reflect.TypeOf(value))
+	}
+
+	return "", true, nil
+}
+
+func encodeGauge(buf *protoBuffer, name string, g *gauge) {
+	// ScopeMetrics.metrics
+	buf.message(2, func(buf *protoBuffer) {
+		buf.string(1, name)
+		if g.unit != "" {
+			buf.string(3, g.unit)
+		}
+
+		// Metric.gauge
+		buf.message(5, func(buf *protoBuffer) {
+			for _, p := range g.points {
+				p := p
+
+				// Gauge.data_points
+				buf.message(1, func(buf *protoBuffer) {
+					buf.fixed64(3, uint64(p.time.UnixNano()))
+
+					if p.isDouble {
+						buf.double(4, p.asDouble)
+					} else {
+						buf.sfixed64(6, p.asInt)
+					}
+
+					encodeAttributes(buf, 7, p.attributes)
+				})
+			}
+		})
+	})
+}
+
+// encodeAttributes writes the attributes as KeyValues with string values, in
+// lexical order.
+func encodeAttributes(buf *protoBuffer, field int, attributes map[string]string) {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := attributes[k]
+		buf.message(field, func(buf *protoBuffer) {
+			buf.string(1, k)
+
+			// KeyValue.value, with AnyValue.string_value
+			buf.message(2, func(buf *protoBuffer) {
+				buf.string(1, v)
+			})
+		})
+	}
+}
+
+func attributesKey(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%q=%q,", k, attributes[k])
+	}
+
+	return sb.String()
+}
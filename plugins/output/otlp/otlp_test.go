@@ -0,0 +1,199 @@
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// protoField is a field of a decoded protobuf message. Embedded messages are
+// left as bytes, to be decoded on demand.
+type protoField struct {
+	num   int
+	value uint64
+	bytes []byte
+}
+
+func decodeProto(t *testing.T, b []byte) map[int][]protoField {
+	fields := make(map[int][]protoField)
+
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.True(t, n > 0)
+		b = b[n:]
+
+		f := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			require.True(t, n > 0)
+			b = b[n:]
+		case wireFixed64:
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			require.True(t, n > 0)
+			f.bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type: %d", key&7)
+		}
+
+		fields[f.num] = append(fields[f.num], f)
+	}
+
+	return fields
+}
+
+// decodeAttributes decodes KeyValues with string values.
+func decodeAttributes(t *testing.T, fields []protoField) map[string]string {
+	result := make(map[string]string)
+
+	for _, f := range fields {
+		kv := decodeProto(t, f.bytes)
+		value := decodeProto(t, kv[2][0].bytes)
+		result[string(kv[1][0].bytes)] = string(value[1][0].bytes)
+	}
+
+	return result
+}
+
+func TestOTLP_encode(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	plugin := OTLP{}
+	plugin.SetResourceTags([]string{"account"})
+
+	data := []metric.Datum{
+		{
+			Name:   "aws_iam_user",
+			Time:   tm,
+			Tags:   map[string]string{"account": "a", "user_name": "alice"},
+			Fields: map[string]interface{}{"age": 90 * time.Second, "active_key_count": 1, "user_arn": "x"},
+		},
+		{
+			Name:   "aws_iam_user",
+			Time:   tm,
+			Tags:   map[string]string{"account": "b", "user_name": "bob"},
+			Fields: map[string]interface{}{"active_key_count": 2},
+		},
+		{
+			Name:   "aws_iam_user",
+			Time:   tm,
+			Tags:   map[string]string{"account": "a", "user_name": "carol"},
+			Fields: map[string]interface{}{"active_key_count": 0},
+		},
+	}
+
+	request := decodeProto(t, plugin.encode(data))
+	require.Equal(t, 2, len(request[1]))
+
+	// the first resource, account a
+	resourceMetrics := decodeProto(t, request[1][0].bytes)
+	resource := decodeProto(t, resourceMetrics[1][0].bytes)
+	require.Equal(t, map[string]string{"account": "a"}, decodeAttributes(t, resource[1]))
+
+	scopeMetrics := decodeProto(t, resourceMetrics[2][0].bytes)
+	scope := decodeProto(t, scopeMetrics[1][0].bytes)
+	require.Equal(t, ScopeName, string(scope[1][0].bytes))
+	require.Equal(t, 2, len(scopeMetrics[2]))
+
+	keyCount := decodeProto(t, scopeMetrics[2][0].bytes)
+	require.Equal(t, "aws_iam_user.active_key_count", string(keyCount[1][0].bytes))
+	require.Empty(t, keyCount[3])
+
+	points := decodeProto(t, keyCount[5][0].bytes)[1]
+	require.Equal(t, 2, len(points))
+
+	first := decodeProto(t, points[0].bytes)
+	require.Equal(t, uint64(tm.UnixNano()), first[3][0].value)
+	require.Equal(t, uint64(1), first[6][0].value)
+	require.Equal(t, map[string]string{"user_name": "alice"}, decodeAttributes(t, first[7]))
+
+	second := decodeProto(t, points[1].bytes)
+	require.Equal(t, uint64(0), second[6][0].value)
+	require.Equal(t, map[string]string{"user_name": "carol"}, decodeAttributes(t, second[7]))
+
+	age := decodeProto(t, scopeMetrics[2][1].bytes)
+	require.Equal(t, "aws_iam_user.age", string(age[1][0].bytes))
+	require.Equal(t, "s", string(age[3][0].bytes))
+
+	point := decodeProto(t, decodeProto(t, age[5][0].bytes)[1][0].bytes)
+	require.Equal(t, float64(90), math.Float64frombits(point[4][0].value))
+
+	// the second resource, account b
+	resourceMetrics = decodeProto(t, request[1][1].bytes)
+	resource = decodeProto(t, resourceMetrics[1][0].bytes)
+	require.Equal(t, map[string]string{"account": "b"}, decodeAttributes(t, resource[1]))
+}
+
+func TestPoint_setValue(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		unit     string
+		ok       bool
+		isDouble bool
+		asInt    int64
+		asDouble float64
+	}{
+		{1, "", true, false, 1, 0},
+		{int64(-2), "", true, false, -2, 0},
+		{uint64(3), "", true, false, 3, 0},
+		{uint64(math.MaxUint64), "", true, true, 0, math.MaxUint64},
+		{1.5, "", true, true, 0, 1.5},
+		{true, "", true, false, 1, 0},
+		{1500 * time.Millisecond, "s", true, true, 0, 1.5},
+		{time.Unix(2, 0), "s", true, true, 0, 2},
+		{"test", "", false, false, 0, 0},
+	}
+
+	for _, test := range tests {
+		var p point
+		unit, ok, err := p.setValue(test.input)
+		require.NoError(t, err)
+		require.Equal(t, test.unit, unit)
+		require.Equal(t, test.ok, ok)
+		require.Equal(t, test.isDouble, p.isDouble)
+		require.Equal(t, test.asInt, p.asInt)
+		require.Equal(t, test.asDouble, p.asDouble)
+	}
+}
+
+func TestOTLP_Output(t *testing.T) {
+	var requests []*http.Request
+	var bodies [][]byte
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(gz)
+		require.NoError(t, err)
+
+		requests = append(requests, r)
+		bodies = append(bodies, b)
+	}))
+	defer s.Close()
+
+	plugin := OTLP{URL: s.URL + "/v1/metrics", Headers: map[string]string{"Authorization": "Bearer x"}}
+	require.NoError(t, plugin.Init())
+
+	ch := make(chan metric.Datum, 1)
+	ch <- metric.Datum{Name: "test", Fields: map[string]interface{}{"f": 1}}
+	close(ch)
+
+	require.NoError(t, plugin.Output(context.Background(), ch))
+	require.Equal(t, 1, len(requests))
+	require.Equal(t, "/v1/metrics", requests[0].URL.Path)
+	require.Equal(t, "application/x-protobuf", requests[0].Header.Get("Content-Type"))
+	require.Equal(t, "Bearer x", requests[0].Header.Get("Authorization"))
+	require.Equal(t, 1, len(decodeProto(t, bodies[0])[1]))
+}
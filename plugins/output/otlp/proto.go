@@ -0,0 +1,78 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// protoBuffer encodes protobuf messages. Scalar fields are only written if
+// they are not the default value, as in proto3, unless they are members of a
+// oneof.
+type protoBuffer struct {
+	b []byte
+}
+
+func (buf *protoBuffer) tag(field, wireType int) {
+	buf.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (buf *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		buf.b = append(buf.b, byte(v)|0x80)
+		v >>= 7
+	}
+
+	buf.b = append(buf.b, byte(v))
+}
+
+func (buf *protoBuffer) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	buf.tag(field, wireFixed64)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	buf.b = append(buf.b, b[:]...)
+}
+
+// double writes the value even if it is zero, as it is a member of a oneof.
+func (buf *protoBuffer) double(field int, v float64) {
+	buf.tag(field, wireFixed64)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	buf.b = append(buf.b, b[:]...)
+}
+
+// sfixed64 writes the value even if it is zero, as it is a member of a oneof.
+func (buf *protoBuffer) sfixed64(field int, v int64) {
+	buf.tag(field, wireFixed64)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(v))
+	buf.b = append(buf.b, b[:]...)
+}
+
+// string writes the value even if it is empty, as it may be a member of a
+// oneof.
+func (buf *protoBuffer) string(field int, s string) {
+	buf.tag(field, wireBytes)
+	buf.varint(uint64(len(s)))
+	buf.b = append(buf.b, s...)
+}
+
+// message writes the embedded message encoded by f.
+func (buf *protoBuffer) message(field int, f func(*protoBuffer)) {
+	var sub protoBuffer
+	f(&sub)
+
+	buf.tag(field, wireBytes)
+	buf.varint(uint64(len(sub.b)))
+	buf.b = append(buf.b, sub.b...)
+}
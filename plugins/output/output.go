@@ -0,0 +1,8 @@
+package output
+
+import (
+	_ "github.com/tetratom/cloudsurvey/plugins/output/graphite"
+	_ "github.com/tetratom/cloudsurvey/plugins/output/influxdb"
+	_ "github.com/tetratom/cloudsurvey/plugins/output/otlp"
+	_ "github.com/tetratom/cloudsurvey/plugins/output/stdout"
+)
@@ -0,0 +1,92 @@
+package stdout
+
+import (
+	"bufio"
+	"context"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"io"
+	"os"
+)
+
+const (
+	PluginName = "stdout"
+)
+
+func init() {
+	registry.AddOutput(
+		PluginName,
+		func() registry.Output {
+			return &Stdout{w: os.Stdout}
+		})
+}
+
+// Stdout writes data to standard output, one per line. By default, data are
+// written in the InfluxDB wire protocol, as expected by the exec input of
+// telegraf.
+type Stdout struct {
+	Format         string `toml:"format"`
+	Precision      string `toml:"precision"`
+	DurationFormat string `toml:"duration_format"`
+	UintSupport    bool   `toml:"uint_support"`
+
+	w      io.Writer
+	format metric.Format
+	opts   metric.WireOptions
+}
+
+func (plugin *Stdout) Init() (err error) {
+	if plugin.format, err = metric.ParseFormat(plugin.Format); err != nil {
+		return err
+	}
+
+	if plugin.opts.Precision, err = metric.ParsePrecision(plugin.Precision); err != nil {
+		return err
+	}
+
+	plugin.opts.Unsigned = plugin.UintSupport
+	plugin.opts.DurationFormat, err = metric.ParseDurationFormat(plugin.DurationFormat)
+	return err
+}
+
+func (plugin *Stdout) Description() string {
+	return "writes metrics to stdout"
+}
+
+func (plugin *Stdout) DefaultConfig() string {
+	return `
+[[outputs.stdout]]
+## "influx" for the influxdb wire protocol, or "json" for json lines
+format = "influx"
+
+## the unit of timestamps in the influxdb wire protocol: s, ms, us or ns
+# precision = "ns"
+
+## the representation of durations in the influxdb wire protocol: "ns" for
+## integer nanoseconds, "s" for integer seconds, or "float_s" for seconds
+# duration_format = "ns"
+
+## write unsigned integers with the u suffix of influxdb 1.4 and later
+# uint_support = false`
+}
+
+func (plugin *Stdout) Output(c context.Context, ch <-chan metric.Datum) error {
+	w := bufio.NewWriter(plugin.w)
+	enc := metric.NewEncoder(w, plugin.format, plugin.opts)
+
+	for datum := range ch {
+		if err := enc.Encode(datum); err != nil {
+			return err
+		}
+
+		// flush whenever the channel runs dry, so that data is not held
+		// back between the executions of a daemon
+		if len(ch) == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,51 @@
+package stdout
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"testing"
+	"time"
+)
+
+func TestStdout_Output(t *testing.T) {
+	datum := metric.Datum{
+		Name:   "test",
+		Time:   time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:   map[string]string{"tag1": "a"},
+		Fields: map[string]interface{}{"field1": 1},
+	}
+
+	tests := []struct {
+		format    string
+		precision string
+		expect    string
+	}{
+		{"", "", "test,tag1=a field1=1i 1546398245000000000\n"},
+		{"influx", "", "test,tag1=a field1=1i 1546398245000000000\n"},
+		{"influx", "s", "test,tag1=a field1=1i 1546398245\n"},
+		{"json", "s", `{"name":"test","time":"2019-01-02T03:04:05Z","timestamp":1546398245000000000,"tags":{"tag1":"a"},"fields":{"field1":1}}` + "\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format+" "+test.precision, func(t *testing.T) {
+			var buf bytes.Buffer
+			plugin := Stdout{Format: test.format, Precision: test.precision, w: &buf}
+			require.NoError(t, plugin.Init())
+
+			ch := make(chan metric.Datum, 2)
+			ch <- datum
+			ch <- datum
+			close(ch)
+
+			require.NoError(t, plugin.Output(context.Background(), ch))
+			require.Equal(t, test.expect+test.expect, buf.String())
+		})
+	}
+
+	t.Run("unknown format", func(t *testing.T) {
+		plugin := Stdout{Format: "xml"}
+		require.EqualError(t, plugin.Init(), "unknown format: xml")
+	})
+}
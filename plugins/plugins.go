@@ -2,5 +2,7 @@ package plugins
 
 import (
 	_ "github.com/tetratom/cloudsurvey/plugins/credentials"
+	_ "github.com/tetratom/cloudsurvey/plugins/output"
+	_ "github.com/tetratom/cloudsurvey/plugins/processor"
 	_ "github.com/tetratom/cloudsurvey/plugins/source"
 )
@@ -0,0 +1,143 @@
+package converter
+
+import (
+	"fmt"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"strconv"
+	"time"
+)
+
+const (
+	PluginName = "converter"
+)
+
+func init() {
+	registry.AddProcessor(
+		PluginName,
+		func() registry.Processor {
+			return &Converter{}
+		})
+}
+
+// Converter converts tags to fields, and fields to tags. The names of tags and
+// fields are given as globs, as matched by metric.MatchGlob.
+type Converter struct {
+	Tags   TagConversion   `toml:"tags"`
+	Fields FieldConversion `toml:"fields"`
+}
+
+// TagConversion lists the tags to convert to fields of each type. A tag whose
+// value cannot be parsed as the type is kept.
+type TagConversion struct {
+	String  []string `toml:"string"`
+	Integer []string `toml:"integer"`
+	Float   []string `toml:"float"`
+	Boolean []string `toml:"boolean"`
+}
+
+// FieldConversion lists the fields to convert to tags.
+type FieldConversion struct {
+	Tag []string `toml:"tag"`
+}
+
+func (plugin *Converter) Description() string {
+	return "converts tags to fields, and fields to tags"
+}
+
+func (plugin *Converter) DefaultConfig() string {
+	return `
+[[processors.converter]]
+## tags to convert to fields of the given type, as globs
+[processors.converter.tags]
+# string = []
+# integer = []
+# float = []
+# boolean = []
+
+## fields to convert to tags, as globs
+[processors.converter.fields]
+# tag = []`
+}
+
+// Process converts the tags before the fields, such that a tag converted to
+// a field is not converted back. A datum left without fields is dropped.
+func (plugin *Converter) Process(datum metric.Datum, collector metric.Collector) {
+	var converted map[string]bool
+
+	for name, value := range datum.Tags {
+		var field interface{}
+		var err error
+
+		switch {
+		case matchAny(plugin.Tags.String, name):
+			field = value
+		case matchAny(plugin.Tags.Integer, name):
+			field, err = strconv.ParseInt(value, 10, 64)
+		case matchAny(plugin.Tags.Float, name):
+			field, err = strconv.ParseFloat(value, 64)
+		case matchAny(plugin.Tags.Boolean, name):
+			field, err = strconv.ParseBool(value)
+		default:
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if datum.Fields == nil {
+			datum.Fields = make(map[string]interface{})
+		}
+
+		if converted == nil {
+			converted = make(map[string]bool)
+		}
+
+		delete(datum.Tags, name)
+		datum.Fields[name] = field
+		converted[name] = true
+	}
+
+	for name, value := range datum.Fields {
+		if converted[name] || !matchAny(plugin.Fields.Tag, name) {
+			continue
+		}
+
+		if datum.Tags == nil {
+			datum.Tags = make(map[string]string)
+		}
+
+		delete(datum.Fields, name)
+		datum.Tags[name] = tagValue(value)
+	}
+
+	if len(datum.Fields) == 0 {
+		return
+	}
+
+	collector.Record(datum)
+}
+
+// tagValue formats the value of a field as a tag. Times are given in RFC 3339
+// format, and durations as by time.Duration.String.
+func tagValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if metric.MatchGlob(pattern, s) {
+			return true
+		}
+	}
+
+	return false
+}
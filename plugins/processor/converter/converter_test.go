@@ -0,0 +1,94 @@
+package converter
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"testing"
+	"time"
+)
+
+func TestConverter_Process(t *testing.T) {
+	plugin := Converter{
+		Tags: TagConversion{
+			String:  []string{"user_path"},
+			Integer: []string{"*_count"},
+			Float:   []string{"ratio"},
+			Boolean: []string{"active"},
+		},
+		Fields: FieldConversion{
+			Tag: []string{"instance_*", "created", "age", "key_*"},
+		},
+	}
+
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		input  metric.Datum
+		expect []metric.Datum
+	}{
+		{
+			input: metric.Datum{
+				Name:   "test",
+				Tags:   map[string]string{"user_path": "/ops/", "key_count": "2", "ratio": "0.5", "active": "true", "region": "eu-west-1"},
+				Fields: map[string]interface{}{"instance_type": "t3.micro", "instance_count": int64(3), "created": tm, "age": time.Hour, "value": 1},
+			},
+			expect: []metric.Datum{{
+				Name: "test",
+				Tags: map[string]string{
+					"region":         "eu-west-1",
+					"instance_type":  "t3.micro",
+					"instance_count": "3",
+					"created":        "2019-01-02T03:04:05Z",
+					"age":            "1h0m0s",
+				},
+				Fields: map[string]interface{}{"user_path": "/ops/", "key_count": int64(2), "ratio": 0.5, "active": true, "value": 1},
+			}},
+		},
+		{
+			// a tag that cannot be parsed is kept
+			input: metric.Datum{
+				Name:   "test",
+				Tags:   map[string]string{"key_count": "many"},
+				Fields: map[string]interface{}{"value": 1},
+			},
+			expect: []metric.Datum{{
+				Name:   "test",
+				Tags:   map[string]string{"key_count": "many"},
+				Fields: map[string]interface{}{"value": 1},
+			}},
+		},
+		{
+			// a tag converted to a field is not converted back
+			input: metric.Datum{
+				Name:   "test",
+				Tags:   map[string]string{"key_count": "2"},
+				Fields: map[string]interface{}{"key_id": "a", "value": 1},
+			},
+			expect: []metric.Datum{{
+				Name:   "test",
+				Tags:   map[string]string{"key_id": "a"},
+				Fields: map[string]interface{}{"key_count": int64(2), "value": 1},
+			}},
+		},
+		{
+			// a datum left without fields is dropped
+			input: metric.Datum{
+				Name:   "test",
+				Fields: map[string]interface{}{"instance_type": "t3.micro"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		ch := make(chan metric.Datum, 1)
+		plugin.Process(test.input, metric.ChannelCollector(ch))
+		close(ch)
+
+		var data []metric.Datum
+		for datum := range ch {
+			data = append(data, datum)
+		}
+
+		require.Equal(t, test.expect, data)
+	}
+}
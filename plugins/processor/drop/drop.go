@@ -0,0 +1,53 @@
+package drop
+
+import (
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+)
+
+const (
+	PluginName = "drop"
+)
+
+func init() {
+	registry.AddProcessor(
+		PluginName,
+		func() registry.Processor {
+			return &Drop{}
+		})
+}
+
+// Drop removes fields from data. The names of the fields are given as globs,
+// as matched by metric.MatchGlob.
+type Drop struct {
+	Fields []string `toml:"fields"`
+}
+
+func (plugin *Drop) Description() string {
+	return "drops fields"
+}
+
+func (plugin *Drop) DefaultConfig() string {
+	return `
+[[processors.drop]]
+## the fields to drop, as globs
+fields = []`
+}
+
+// Process removes the fields, and drops a datum left without fields.
+func (plugin *Drop) Process(datum metric.Datum, collector metric.Collector) {
+	for name := range datum.Fields {
+		for _, pattern := range plugin.Fields {
+			if metric.MatchGlob(pattern, name) {
+				delete(datum.Fields, name)
+				break
+			}
+		}
+	}
+
+	if len(datum.Fields) == 0 {
+		return
+	}
+
+	collector.Record(datum)
+}
@@ -0,0 +1,38 @@
+package drop
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"testing"
+)
+
+func TestDrop_Process(t *testing.T) {
+	plugin := Drop{Fields: []string{"*_count", "age"}}
+
+	tests := []struct {
+		input  map[string]interface{}
+		expect []metric.Datum
+	}{
+		{
+			input:  map[string]interface{}{"age": 1, "key_count": 2, "value": 3},
+			expect: []metric.Datum{{Name: "test", Fields: map[string]interface{}{"value": 3}}},
+		},
+		{
+			input:  map[string]interface{}{"age": 1, "key_count": 2},
+			expect: nil,
+		},
+	}
+
+	for _, test := range tests {
+		ch := make(chan metric.Datum, 1)
+		plugin.Process(metric.Datum{Name: "test", Fields: test.input}, metric.ChannelCollector(ch))
+		close(ch)
+
+		var data []metric.Datum
+		for datum := range ch {
+			data = append(data, datum)
+		}
+
+		require.Equal(t, test.expect, data)
+	}
+}
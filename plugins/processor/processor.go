@@ -0,0 +1,8 @@
+package processor
+
+import (
+	_ "github.com/tetratom/cloudsurvey/plugins/processor/converter"
+	_ "github.com/tetratom/cloudsurvey/plugins/processor/drop"
+	_ "github.com/tetratom/cloudsurvey/plugins/processor/regex"
+	_ "github.com/tetratom/cloudsurvey/plugins/processor/rename"
+)
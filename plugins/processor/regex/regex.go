@@ -0,0 +1,92 @@
+package regex
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+	"regexp"
+)
+
+const (
+	PluginName = "regex"
+)
+
+func init() {
+	registry.AddProcessor(
+		PluginName,
+		func() registry.Processor {
+			return &Regex{}
+		})
+}
+
+// Regex rewrites the values of tags with regular expressions. The rewrites are
+// applied in order.
+type Regex struct {
+	Tags []Rewrite `toml:"tags"`
+
+	patterns []*regexp.Regexp
+}
+
+// Rewrite replaces the value of the tag Key, if it matches Pattern, with
+// Replacement, in which $1 or ${1} stand for the submatches of the pattern.
+// If ResultKey is set, the result is written to that tag instead, and the
+// original tag is kept.
+type Rewrite struct {
+	Key         string `toml:"key"`
+	Pattern     string `toml:"pattern"`
+	Replacement string `toml:"replacement"`
+	ResultKey   string `toml:"result_key"`
+}
+
+func (plugin *Regex) Init() error {
+	plugin.patterns = make([]*regexp.Regexp, len(plugin.Tags))
+
+	for i, rewrite := range plugin.Tags {
+		if rewrite.Key == "" {
+			return errors.Errorf("tags[%d]: missing key", i)
+		}
+
+		pattern, err := regexp.Compile(rewrite.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "tags[%d]", i)
+		}
+
+		plugin.patterns[i] = pattern
+	}
+
+	return nil
+}
+
+func (plugin *Regex) Description() string {
+	return "rewrites tag values with regular expressions"
+}
+
+func (plugin *Regex) DefaultConfig() string {
+	return `
+[[processors.regex]]
+## each rewrite replaces the value of the tag key, if it matches the pattern,
+## with the replacement, or writes the result to result_key if set
+# [[processors.regex.tags]]
+# key = "user_path"
+# pattern = "^/([^/]+)/.*$"
+# replacement = "$1"
+# result_key = "team"`
+}
+
+func (plugin *Regex) Process(datum metric.Datum, collector metric.Collector) {
+	for i, rewrite := range plugin.Tags {
+		value, ok := datum.Tags[rewrite.Key]
+		if !ok || !plugin.patterns[i].MatchString(value) {
+			continue
+		}
+
+		key := rewrite.Key
+		if rewrite.ResultKey != "" {
+			key = rewrite.ResultKey
+		}
+
+		datum.Tags[key] = plugin.patterns[i].ReplaceAllString(value, rewrite.Replacement)
+	}
+
+	collector.Record(datum)
+}
@@ -0,0 +1,48 @@
+package regex
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"testing"
+)
+
+func TestRegex_Process(t *testing.T) {
+	plugin := Regex{Tags: []Rewrite{
+		{Key: "user_path", Pattern: "^/([^/]+)/.*$", Replacement: "$1", ResultKey: "team"},
+		{Key: "user_path", Pattern: "^/[^/]+/([^/]+)/$", Replacement: "${1}_role", ResultKey: "role"},
+		{Key: "region", Pattern: "^eu-", Replacement: "europe-"},
+	}}
+	require.NoError(t, plugin.Init())
+
+	tests := []struct {
+		input  map[string]string
+		expect map[string]string
+	}{
+		{
+			input:  map[string]string{"user_path": "/ops/admins/", "region": "eu-west-1"},
+			expect: map[string]string{"user_path": "/ops/admins/", "team": "ops", "role": "admins_role", "region": "europe-west-1"},
+		},
+		{
+			input:  map[string]string{"user_path": "/", "region": "us-east-1"},
+			expect: map[string]string{"user_path": "/", "region": "us-east-1"},
+		},
+		{
+			input:  nil,
+			expect: nil,
+		},
+	}
+
+	for _, test := range tests {
+		ch := make(chan metric.Datum, 1)
+		plugin.Process(metric.Datum{Name: "test", Tags: test.input}, metric.ChannelCollector(ch))
+		require.Equal(t, metric.Datum{Name: "test", Tags: test.expect}, <-ch)
+	}
+}
+
+func TestRegex_Init(t *testing.T) {
+	plugin := Regex{Tags: []Rewrite{{Key: "a", Pattern: "("}}}
+	require.EqualError(t, plugin.Init(), "tags[0]: error parsing regexp: missing closing ): `(`")
+
+	plugin = Regex{Tags: []Rewrite{{Pattern: "a"}}}
+	require.EqualError(t, plugin.Init(), "tags[0]: missing key")
+}
@@ -0,0 +1,95 @@
+package rename
+
+import (
+	"github.com/pkg/errors"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"github.com/tetratom/cloudsurvey/pkg/registry"
+)
+
+const (
+	PluginName = "rename"
+)
+
+func init() {
+	registry.AddProcessor(
+		PluginName,
+		func() registry.Processor {
+			return &Rename{}
+		})
+}
+
+// Rename renames the measurements, tags and fields of data. The replacements
+// are applied in order, such that a later one sees the names given by those
+// before it.
+type Rename struct {
+	Replace []Replacement `toml:"replace"`
+}
+
+// Replacement renames either a measurement, a tag or a field to Dest.
+type Replacement struct {
+	Measurement string `toml:"measurement"`
+	Tag         string `toml:"tag"`
+	Field       string `toml:"field"`
+	Dest        string `toml:"dest"`
+}
+
+func (plugin *Rename) Init() error {
+	for i, r := range plugin.Replace {
+		var n int
+		for _, name := range []string{r.Measurement, r.Tag, r.Field} {
+			if name != "" {
+				n++
+			}
+		}
+
+		if n != 1 {
+			return errors.Errorf("replace[%d]: exactly one of measurement, tag or field is required", i)
+		}
+
+		if r.Dest == "" {
+			return errors.Errorf("replace[%d]: missing dest", i)
+		}
+	}
+
+	return nil
+}
+
+func (plugin *Rename) Description() string {
+	return "renames measurements, tags and fields"
+}
+
+func (plugin *Rename) DefaultConfig() string {
+	return `
+[[processors.rename]]
+## each replacement renames one of a measurement, a tag or a field to dest
+# [[processors.rename.replace]]
+# measurement = "aws_iam_user"
+# dest = "iam_user"
+
+# [[processors.rename.replace]]
+# tag = "user_name"
+# dest = "user"`
+}
+
+func (plugin *Rename) Process(datum metric.Datum, collector metric.Collector) {
+	for _, r := range plugin.Replace {
+		switch {
+		case r.Measurement != "":
+			if datum.Name == r.Measurement {
+				datum.Name = r.Dest
+			}
+		case r.Tag != "":
+			if value, ok := datum.Tags[r.Tag]; ok {
+				delete(datum.Tags, r.Tag)
+				datum.Tags[r.Dest] = value
+			}
+		case r.Field != "":
+			if value, ok := datum.Fields[r.Field]; ok {
+				delete(datum.Fields, r.Field)
+				datum.Fields[r.Dest] = value
+			}
+		}
+	}
+
+	collector.Record(datum)
+}
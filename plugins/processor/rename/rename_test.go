@@ -0,0 +1,59 @@
+package rename
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/tetratom/cloudsurvey/pkg/metric"
+	"testing"
+)
+
+func TestRename_Process(t *testing.T) {
+	plugin := Rename{Replace: []Replacement{
+		{Measurement: "aws_iam_user", Dest: "iam_user"},
+		{Tag: "user_name", Dest: "user"},
+		{Field: "age", Dest: "user_age"},
+		{Tag: "user", Dest: "name"},
+	}}
+	require.NoError(t, plugin.Init())
+
+	tests := []struct {
+		input  metric.Datum
+		expect metric.Datum
+	}{
+		{
+			input: metric.Datum{
+				Name:   "aws_iam_user",
+				Tags:   map[string]string{"user_name": "alice", "account": "a"},
+				Fields: map[string]interface{}{"age": 1, "active_key_count": 2},
+			},
+			expect: metric.Datum{
+				Name:   "iam_user",
+				Tags:   map[string]string{"name": "alice", "account": "a"},
+				Fields: map[string]interface{}{"user_age": 1, "active_key_count": 2},
+			},
+		},
+		{
+			input: metric.Datum{
+				Name:   "aws_ec2_instance",
+				Fields: map[string]interface{}{"count": 1},
+			},
+			expect: metric.Datum{
+				Name:   "aws_ec2_instance",
+				Fields: map[string]interface{}{"count": 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		ch := make(chan metric.Datum, 1)
+		plugin.Process(test.input, metric.ChannelCollector(ch))
+		require.Equal(t, test.expect, <-ch)
+	}
+}
+
+func TestRename_Init(t *testing.T) {
+	plugin := Rename{Replace: []Replacement{{Tag: "a", Field: "b", Dest: "c"}}}
+	require.EqualError(t, plugin.Init(), "replace[0]: exactly one of measurement, tag or field is required")
+
+	plugin = Rename{Replace: []Replacement{{Tag: "a"}}}
+	require.EqualError(t, plugin.Init(), "replace[0]: missing dest")
+}
@@ -22,9 +22,11 @@ func init() {
 	registry.AddSource(
 		LogGroupsPluginName,
 		func(sess registry.Session) registry.Source {
-			return &LogGroups{
-				api: cloudwatchlogs.New(sess.(*session.Session)),
+			x := LogGroups{}
+			if sess != nil {
+				x.api = cloudwatchlogs.New(sess.(*session.Session))
 			}
+			return &x
 		})
 }
 
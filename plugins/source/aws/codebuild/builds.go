@@ -22,9 +22,11 @@ func init() {
 	registry.AddSource(
 		BuildsPluginName,
 		func(sess registry.Session) registry.Source {
-			return &Builds{
-				api: codebuild.New(sess.(*session.Session)),
+			x := Builds{}
+			if sess != nil {
+				x.api = codebuild.New(sess.(*session.Session))
 			}
+			return &x
 		})
 }
 
@@ -37,9 +37,11 @@ func init() {
 	registry.AddSource(
 		DailyPluginName,
 		func(sess registry.Session) registry.Source {
-			return &Daily{
-				api: costexplorer.New(sess.(*session.Session)),
+			x := Daily{}
+			if sess != nil {
+				x.api = costexplorer.New(sess.(*session.Session))
 			}
+			return &x
 		})
 }
 
@@ -24,9 +24,11 @@ func init() {
 	registry.AddSource(
 		ClientVpnPluginName,
 		func(sess registry.Session) registry.Source {
-			return &ClientVPN{
-				api: ec2.New(sess.(*session.Session)),
+			x := ClientVPN{}
+			if sess != nil {
+				x.api = ec2.New(sess.(*session.Session))
 			}
+			return &x
 		})
 }
 
@@ -35,7 +37,7 @@ type ClientVPN struct {
 }
 
 func (plugin *ClientVPN) Description() string {
-	return ""
+	return "get stats about client vpn connections"
 }
 
 func (plugin *ClientVPN) DefaultConfig() string {
@@ -25,9 +25,11 @@ func init() {
 	registry.AddSource(
 		InstancesPluginName,
 		func(sess registry.Session) registry.Source {
-			return &Instances{
-				api: ec2.New(sess.(*session.Session)),
+			x := Instances{}
+			if sess != nil {
+				x.api = ec2.New(sess.(*session.Session))
 			}
+			return &x
 		})
 }
 
@@ -22,9 +22,11 @@ func init() {
 	registry.AddSource(
 		UsersPluginName,
 		func(cred registry.Session) registry.Source {
-			return &Users{
-				api: iam.New(cred.(*session.Session)),
+			x := Users{}
+			if cred != nil {
+				x.api = iam.New(cred.(*session.Session))
 			}
+			return &x
 		})
 }
 